@@ -6,7 +6,13 @@
 package omnis
 
 import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
 	"github.com/phuslu/log"
+	"github.com/ternarybob/arbor"
 )
 
 const (
@@ -35,3 +41,96 @@ func warnLogger() log.Logger {
 		},
 	}
 }
+
+// isDevScope reports whether the service config describes a development scope
+// A missing config or empty scope is treated as development
+func isDevScope(config *ServiceConfig) bool {
+	if config == nil {
+		return true
+	}
+	scope := strings.ToUpper(config.Scope)
+	return scope == "" || scope == "DEV" || scope == "DEVELOPMENT"
+}
+
+// hasDevScope reports whether the service config sets a development scope
+// Unlike isDevScope, a missing config or empty scope is not development, so stacks are never exposed by default
+func hasDevScope(config *ServiceConfig) bool {
+	return config != nil && config.Scope != "" && isDevScope(config)
+}
+
+// stackTrace returns the current call stack formatted as function/location pairs
+// skip is the number of callers to omit, not counting stackTrace itself
+func stackTrace(skip int) []string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	stack := []string{}
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			stack = append(stack, fmt.Sprintf("%s()", frame.Function))
+			stack = append(stack, fmt.Sprintf("  %s:%d", frame.File, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+
+	return stack
+}
+
+// memoryLogs retrieves the memory logs for a correlation ID and formats them for ApiResponse.Log
+// The config selects the legacy or structured format and caps the entries; nil uses the legacy format
+func memoryLogs(logger arbor.ILogger, correlationID string, level arbor.LogLevel, config *JSONRendererConfig) map[string]interface{} {
+	if logger == nil {
+		return map[string]interface{}{
+			"status": "no logs found - request logger not set",
+		}
+	}
+
+	if correlationID == "" {
+		return map[string]interface{}{
+			"status": "request logger set but no correlation ID found",
+		}
+	}
+
+	// A MemoryLogStore keeps the log events, so its entries need not be parsed from lines
+	if store := registeredMemoryLogStore(); store != nil {
+		return storeLogs(store, correlationID, level, config)
+	}
+
+	logs, err := logger.GetMemoryLogs(correlationID, level)
+	if err != nil || len(logs) == 0 {
+		return map[string]interface{}{
+			"status": "request logger set but no logs captured for correlation ID",
+		}
+	}
+
+	entries, dropped := logEntries(logs, config)
+	response := map[string]interface{}{
+		"count":   len(logs) - dropped,
+		"entries": entries,
+	}
+	if dropped > 0 {
+		response["dropped"] = dropped
+	}
+	return response
+}
+
+// resolveLogger returns the request logger, falling back to the configured default logger
+func resolveLogger(ctx *gin.Context, config *JSONRendererConfig) arbor.ILogger {
+	if ctx != nil {
+		if loggerInterface, exists := ctx.Get(REQUEST_LOGGER); exists {
+			if requestLogger, ok := loggerInterface.(arbor.ILogger); ok {
+				return requestLogger
+			}
+		}
+	}
+
+	if config != nil {
+		return config.DefaultLogger
+	}
+
+	return nil
+}
@@ -7,3 +7,58 @@ package omnis
 
 // REQUEST_LOGGER is the key used to store request-specific loggers in gin.Context
 const REQUEST_LOGGER = "omnis_request_logger"
+
+// ENVELOPE_RENDERED is the key set in gin.Context when the response body is already an ApiResponse
+const ENVELOPE_RENDERED = "omnis_envelope_rendered"
+
+// REQUEST_BODY is the key used to store the captured start of the request body in gin.Context
+const REQUEST_BODY = "omnis_request_body"
+
+// RENDERER_CONFIG is the key used to store the JSONMiddleware configuration in gin.Context, for RenderService
+const RENDERER_CONFIG = "omnis_renderer_config"
+
+// LOG_BUFFER is the key used to store the request's log buffer in gin.Context
+const LOG_BUFFER = "omnis_log_buffer"
+
+// CORRELATION_ID_OWNED is the key set in gin.Context when the correlation ID was generated by omnis or
+// accepted by a correlation policy, rather than taken verbatim from the caller
+const CORRELATION_ID_OWNED = "omnis_correlation_id_owned"
+
+// SKIP_ENVELOPE is the key set in gin.Context to write the response body without an envelope
+const SKIP_ENVELOPE = "omnis_skip_envelope"
+
+// Response formats for JSONRendererConfig.ResponseFormat
+const (
+	FORMAT_APIRESPONSE = "apiresponse" // ApiResponse envelope (default)
+	FORMAT_STANDARD    = "standard"    // Original body without an envelope
+	FORMAT_PROBLEM     = "problem"     // RFC 9457 problem details for errors
+	FORMAT_JSONAPI     = "jsonapi"     // JSON:API document
+)
+
+// Log formats for JSONRendererConfig.LogFormat
+const (
+	LOG_FORMAT_LEGACY     = "legacy"     // Entries keyed by index as "LVL|time|prefix|message" strings (default)
+	LOG_FORMAT_STRUCTURED = "structured" // Ordered LogEntry values
+)
+
+// PROBLEM_CONTENT_TYPE is the media type of RFC 9457 problem details responses
+const PROBLEM_CONTENT_TYPE = "application/problem+json"
+
+// JSONAPI_CONTENT_TYPE is the media type of JSON:API documents
+const JSONAPI_CONTENT_TYPE = "application/vnd.api+json"
+
+// Media types served by the built-in envelope encoders
+const (
+	JSON_CONTENT_TYPE     = "application/json"
+	XML_CONTENT_TYPE      = "application/xml"
+	YAML_CONTENT_TYPE     = "application/yaml"
+	MSGPACK_CONTENT_TYPE  = "application/msgpack"
+	CBOR_CONTENT_TYPE     = "application/cbor"
+	PROTOBUF_CONTENT_TYPE = "application/x-protobuf"
+)
+
+// DEBUG_TOKEN_HEADER is the request header carrying a debug token (see NewDebugToken)
+const DEBUG_TOKEN_HEADER = "X-Omnis-Debug-Token"
+
+// LOG_LEVEL_HEADER is the request header that lowers the captured log level for an authorized request
+const LOG_LEVEL_HEADER = "X-Omnis-Log-Level"
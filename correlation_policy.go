@@ -0,0 +1,141 @@
+// -----------------------------------------------------------------------
+// Correlation Policy
+// Validates correlation IDs sent by callers before SetCorrelationID uses them
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CLIENT_CORRELATION_ID_KEY is the key used to store a caller's correlation ID that was not accepted in gin.Context
+const CLIENT_CORRELATION_ID_KEY = "client_correlation_id"
+
+// Correlation ID length limits, in bytes
+const (
+	DEFAULT_MAX_CORRELATION_ID_LENGTH = 128
+	MAX_CLIENT_CORRELATION_ID_LENGTH  = 256 // The sanitized original kept for auditing
+)
+
+// defaultCorrelationIDPattern allows letters, digits, '.', '_', ':' and '-', which covers UUIDs,
+// ULIDs, KSUIDs, snowflakes and trace IDs
+var defaultCorrelationIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+var (
+	errCorrelationIDLength = errors.New("correlation ID exceeds the maximum length")
+	errCorrelationIDFormat = errors.New("correlation ID contains characters that are not allowed")
+)
+
+// CorrelationPolicy controls which correlation IDs sent by callers are used
+// An ID is used when it comes from a trusted source and is valid. IDs from untrusted sources are replaced
+// with a generated ID; invalid IDs are too, or are rejected with a 400 envelope when Reject is set.
+// Either way the original is kept, sanitized, as client_correlation_id for auditing.
+// Without trusted proxies or an authorizer, every source is trusted
+type CorrelationPolicy struct {
+	MaxLength      int                       // Maximum length in bytes (default: 128)
+	Pattern        *regexp.Regexp            // Allowed format (default: letters, digits, '.', '_', ':' and '-')
+	TrustedProxies []string                  // IPs or CIDR ranges of the direct peer, matched against c.RemoteIP()
+	Authorizer     func(c *gin.Context) bool // Trusts authenticated clients, e.g. by API key; runs before later middleware
+	Reject         bool                      // Reject invalid IDs with 400 instead of replacing them
+	Renderer       *JSONRendererConfig       // Service metadata and format of the 400 envelope
+}
+
+// Trusted reports whether correlation IDs from the request's source may be used
+func (p *CorrelationPolicy) Trusted(c *gin.Context) bool {
+	if p == nil || (len(p.TrustedProxies) == 0 && p.Authorizer == nil) {
+		return true
+	}
+	if c == nil {
+		return false
+	}
+
+	if ipAllowed(c.RemoteIP(), p.TrustedProxies) {
+		return true
+	}
+
+	return p.Authorizer != nil && p.Authorizer(c)
+}
+
+// Validate checks the correlation ID against the maximum length and allowed format
+func (p *CorrelationPolicy) Validate(correlationID string) error {
+	if p == nil {
+		return nil
+	}
+
+	maxLength := p.MaxLength
+	if maxLength <= 0 {
+		maxLength = DEFAULT_MAX_CORRELATION_ID_LENGTH
+	}
+	if len(correlationID) > maxLength {
+		return errCorrelationIDLength
+	}
+
+	pattern := p.Pattern
+	if pattern == nil {
+		pattern = defaultCorrelationIDPattern
+	}
+	if !pattern.MatchString(correlationID) {
+		return errCorrelationIDFormat
+	}
+
+	return nil
+}
+
+// accept reports whether the caller's correlation ID may be used, and the validation error if it is invalid
+// A caller's ID that is not used is stored, sanitized, under CLIENT_CORRELATION_ID_KEY
+func (p *CorrelationPolicy) accept(c *gin.Context, correlationID string) (bool, error) {
+	if !p.Trusted(c) {
+		c.Set(CLIENT_CORRELATION_ID_KEY, sanitizeCorrelationID(correlationID))
+		return false, nil
+	}
+
+	if err := p.Validate(correlationID); err != nil {
+		c.Set(CLIENT_CORRELATION_ID_KEY, sanitizeCorrelationID(correlationID))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// reject renders the 400 envelope for an invalid correlation ID and aborts the request
+func (p *CorrelationPolicy) reject(c *gin.Context, err error) {
+	var serviceConfig *ServiceConfig
+	if p.Renderer != nil {
+		serviceConfig = p.Renderer.ServiceConfig
+	}
+
+	render := &renderservice{
+		ctx:      c,
+		config:   serviceConfig,
+		renderer: p.Renderer,
+	}
+
+	response := render.newResponse(http.StatusBadRequest)
+	response.Error = err.Error()
+
+	render.render(http.StatusBadRequest, response)
+
+	c.Abort()
+}
+
+// sanitizeCorrelationID escapes control and non-ASCII characters and truncates the ID,
+// so it can be logged and returned safely
+func sanitizeCorrelationID(correlationID string) string {
+	quoted := strconv.QuoteToASCII(correlationID)
+	return truncateMessage(quoted[1:len(quoted)-1], MAX_CLIENT_CORRELATION_ID_LENGTH)
+}
+
+// GetClientCorrelationID retrieves the sanitized correlation ID the caller sent when the correlation
+// policy did not accept it, or "" if the caller's ID was used or none was sent
+func GetClientCorrelationID(c *gin.Context) string {
+	if c == nil {
+		return ""
+	}
+	return c.GetString(CLIENT_CORRELATION_ID_KEY)
+}
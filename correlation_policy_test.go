@@ -0,0 +1,164 @@
+// -----------------------------------------------------------------------
+// Correlation Policy Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelationPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Validate", func(t *testing.T) {
+		policy := &CorrelationPolicy{}
+		assert.NoError(t, policy.Validate("f47ac10b-58cc-4372-a567-0e02b2c3d479"))
+		assert.NoError(t, policy.Validate("01JA7Q9Y0R8V3T6K2M4N5P7Q8R"))
+		assert.NoError(t, policy.Validate("order.123_retry:2"))
+		assert.ErrorIs(t, policy.Validate(strings.Repeat("a", DEFAULT_MAX_CORRELATION_ID_LENGTH+1)), errCorrelationIDLength)
+		assert.ErrorIs(t, policy.Validate("abc\r\nINF|forged log line"), errCorrelationIDFormat)
+		assert.ErrorIs(t, policy.Validate("<script>"), errCorrelationIDFormat)
+		assert.ErrorIs(t, policy.Validate(""), errCorrelationIDFormat)
+
+		custom := &CorrelationPolicy{MaxLength: 8, Pattern: regexp.MustCompile(`^[0-9]+$`)}
+		assert.NoError(t, custom.Validate("12345678"))
+		assert.ErrorIs(t, custom.Validate("123456789"), errCorrelationIDLength)
+		assert.ErrorIs(t, custom.Validate("abc"), errCorrelationIDFormat)
+
+		var none *CorrelationPolicy
+		assert.NoError(t, none.Validate("anything goes\n"))
+	})
+
+	t.Run("Trusted", func(t *testing.T) {
+		newContext := func(remoteAddr string, apiKey string) *gin.Context {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			c.Request.RemoteAddr = remoteAddr
+			c.Request.Header.Set("X-Api-Key", apiKey)
+			// The forwarded client IP is not the direct peer
+			c.Request.Header.Set("X-Forwarded-For", "10.0.0.5")
+			return c
+		}
+
+		policy := &CorrelationPolicy{
+			TrustedProxies: []string{"10.0.0.0/8", "192.168.1.10"},
+			Authorizer:     func(c *gin.Context) bool { return c.GetHeader("X-Api-Key") == "secret" },
+		}
+		assert.True(t, policy.Trusted(newContext("10.1.2.3:5000", "")))
+		assert.True(t, policy.Trusted(newContext("192.168.1.10:5000", "")))
+		assert.True(t, policy.Trusted(newContext("203.0.113.7:5000", "secret")))
+		assert.False(t, policy.Trusted(newContext("203.0.113.7:5000", "")))
+
+		// Without trust rules, every source is trusted
+		assert.True(t, (&CorrelationPolicy{}).Trusted(newContext("203.0.113.7:5000", "")))
+	})
+
+	t.Run("Sanitize", func(t *testing.T) {
+		assert.Equal(t, `abc\r\nINF|forged`, sanitizeCorrelationID("abc\r\nINF|forged"))
+		assert.Equal(t, `caf\u00e9`, sanitizeCorrelationID("café"))
+		assert.Len(t, sanitizeCorrelationID(strings.Repeat("a", 10000)), MAX_CLIENT_CORRELATION_ID_LENGTH+len(LOG_TRUNCATION_SUFFIX))
+	})
+}
+
+func TestCorrelationPolicyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(policy *CorrelationPolicy) *gin.Engine {
+		return newTestRouter(
+			&CorrelationConfig{Generator: SequentialGenerator("generated-"), Policy: policy},
+			&JSONRendererConfig{ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "PRD"}},
+			"/orders", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"client": GetClientCorrelationID(c)})
+			})
+	}
+
+	type envelope struct {
+		Status              int               `json:"status"`
+		Name                string            `json:"name"`
+		CorrelationId       string            `json:"correlationid"`
+		ClientCorrelationId string            `json:"client_correlation_id"`
+		Result              map[string]string `json:"result"`
+		Error               string            `json:"error"`
+	}
+
+	t.Run("Accepts Valid IDs", func(t *testing.T) {
+		w := serveTestRequest(newRouter(&CorrelationPolicy{}), "/orders",
+			withHeader("X-Correlation-ID", "order-123"), withRemoteAddr("203.0.113.7:5000"))
+		response := decodeTestResponse[envelope](t, w)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "order-123", response.CorrelationId)
+		assert.Empty(t, response.ClientCorrelationId)
+		assert.Equal(t, "order-123", w.Header().Get("X-Correlation-ID"))
+	})
+
+	t.Run("Regenerates Invalid IDs", func(t *testing.T) {
+		w := serveTestRequest(newRouter(&CorrelationPolicy{}), "/orders",
+			withHeader("X-Correlation-ID", "abc\tINF|forged"), withRemoteAddr("203.0.113.7:5000"))
+		response := decodeTestResponse[envelope](t, w)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "generated-000001", response.CorrelationId)
+		assert.Equal(t, "generated-000001", w.Header().Get("X-Correlation-ID"))
+		assert.Equal(t, `abc\tINF|forged`, response.ClientCorrelationId)
+		assert.Equal(t, `abc\tINF|forged`, response.Result["client"])
+	})
+
+	t.Run("Rejects Invalid IDs", func(t *testing.T) {
+		r := newRouter(&CorrelationPolicy{
+			MaxLength: 16,
+			Reject:    true,
+			Renderer:  &JSONRendererConfig{ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "PRD"}},
+		})
+
+		w := serveTestRequest(r, "/orders", withHeader("X-Correlation-ID", strings.Repeat("x", 17)), withRemoteAddr("203.0.113.7:5000"))
+		response := decodeTestResponse[envelope](t, w)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "test-service", response.Name)
+		assert.Equal(t, errCorrelationIDLength.Error(), response.Error)
+		assert.Equal(t, "generated-000001", response.CorrelationId)
+		assert.Equal(t, "generated-000001", w.Header().Get("X-Correlation-ID"))
+		assert.Equal(t, strings.Repeat("x", 17), response.ClientCorrelationId)
+		assert.Nil(t, response.Result)
+	})
+
+	t.Run("Replaces IDs From Untrusted Sources", func(t *testing.T) {
+		r := newRouter(&CorrelationPolicy{TrustedProxies: []string{"10.0.0.0/8"}, Reject: true})
+
+		w := serveTestRequest(r, "/orders", withHeader("X-Correlation-ID", "spoofed-id"), withRemoteAddr("203.0.113.7:5000"))
+		response := decodeTestResponse[envelope](t, w)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "generated-000001", response.CorrelationId)
+		assert.Equal(t, "spoofed-id", response.ClientCorrelationId)
+
+		w = serveTestRequest(r, "/orders", withHeader("X-Correlation-ID", "proxied-id"), withRemoteAddr("10.0.0.2:5000"))
+		response = decodeTestResponse[envelope](t, w)
+		assert.Equal(t, "proxied-id", response.CorrelationId)
+		assert.Empty(t, response.ClientCorrelationId)
+	})
+
+	t.Run("Ignores Trace IDs From Untrusted Sources", func(t *testing.T) {
+		const traceID = "0af7651916cd43dd8448eb211c80319c"
+		r := newRouter(&CorrelationPolicy{TrustedProxies: []string{"10.0.0.0/8"}})
+		traceparent := withHeader("traceparent", "00-"+traceID+"-b7ad6b7169203331-01")
+
+		// The caller's trace ID does not become the correlation ID
+		response := decodeTestResponse[envelope](t, serveTestRequest(r, "/orders", traceparent, withRemoteAddr("203.0.113.9:5000")))
+		assert.Equal(t, "generated-000001", response.CorrelationId)
+
+		response = decodeTestResponse[envelope](t, serveTestRequest(r, "/orders", traceparent, withRemoteAddr("10.0.0.2:5000")))
+		assert.Equal(t, traceID, response.CorrelationId)
+	})
+
+	t.Run("Trusts Verbatim Without A Policy", func(t *testing.T) {
+		w := serveTestRequest(newRouter(nil), "/orders", withHeader("X-Correlation-ID", "anything <goes>"), withRemoteAddr("203.0.113.7:5000"))
+		response := decodeTestResponse[envelope](t, w)
+		assert.Equal(t, "anything <goes>", response.CorrelationId)
+	})
+}
@@ -0,0 +1,69 @@
+// -----------------------------------------------------------------------
+// Correlation Service
+// Fluent interface for setting and reading the request's correlation ID
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNoContext is returned when a correlation ID is set without a gin context
+var errNoContext = errors.New("correlation service has no gin context")
+
+type gincorrelation struct {
+	ctx       *gin.Context
+	generator IGenerator
+}
+
+// CorrelationService creates a correlation service for the gin context, generating UUIDv4 IDs
+// Usage: id, err := omnis.CorrelationService(c).WithGenerator(omnis.ULIDGenerator()).SetCorrelationID()
+func CorrelationService(ctx *gin.Context) ICorrelationService {
+	return &gincorrelation{
+		ctx:       ctx,
+		generator: UUIDv4Generator(),
+	}
+}
+
+// WithContext sets the gin context whose correlation ID is set and read
+func (s *gincorrelation) WithContext(ctx *gin.Context) ICorrelationService {
+	s.ctx = ctx
+	return s
+}
+
+// WithGenerator sets the generator for new correlation IDs; nil restores the UUIDv4 default
+func (s *gincorrelation) WithGenerator(generator IGenerator) ICorrelationService {
+	if generator == nil {
+		generator = UUIDv4Generator()
+	}
+	s.generator = generator
+	return s
+}
+
+// SetCorrelationID returns the request's correlation ID, or generates one and sets it in the
+// context and response headers if none is set
+func (s *gincorrelation) SetCorrelationID() (string, error) {
+	if s.ctx == nil {
+		return "", errNoContext
+	}
+
+	if correlationID := s.ctx.GetString(CORRELATION_ID_KEY); correlationID != "" {
+		return correlationID, nil
+	}
+
+	correlationID, err := s.generator.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	setCorrelationID(s.ctx, correlationID, true)
+	return correlationID, nil
+}
+
+// GetCorrelationID retrieves the correlation ID, or "unknown" if not found
+func (s *gincorrelation) GetCorrelationID() string {
+	return GetCorrelationID(s.ctx)
+}
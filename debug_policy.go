@@ -0,0 +1,152 @@
+// -----------------------------------------------------------------------
+// Debug Policy
+// Authorizes the ?debug envelope outside DEV scope
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DebugPolicy controls which requests may use ?debug outside DEV scope, where it is always allowed
+// A request is authorized by any one of a valid debug token, an allowed client IP or the authorizer
+// Without a policy, ?debug is ignored outside DEV scope, which needs to be set explicitly
+type DebugPolicy struct {
+	Secret         []byte                    // HMAC-SHA256 key for debug tokens (see NewDebugToken)
+	AllowedIPs     []string                  // Client IPs or CIDR ranges, matched against the client IP (see TrustedProxies)
+	TrustedProxies []string                  // IPs or CIDR ranges of proxies whose X-Forwarded-For is used; otherwise c.RemoteIP() is the client IP
+	Authorizer     func(c *gin.Context) bool // Custom authorization, e.g. an admin role check
+}
+
+// debugRequested reports whether ?debug is present, with or without a value, and the request may use it:
+// always in DEV scope, otherwise only when the debug policy authorizes it
+// Without a service config or scope, the scope is not DEV
+func debugRequested(c *gin.Context, config *JSONRendererConfig) bool {
+	if c == nil || config == nil {
+		return false
+	}
+	if _, exists := c.GetQuery("debug"); !exists {
+		return false
+	}
+
+	if hasDevScope(config.ServiceConfig) {
+		return true
+	}
+	return config.DebugPolicy.Authorized(c)
+}
+
+// NewDebugToken creates a debug token for a correlation ID, valid until expires
+// The token is passed as ?debug=<token> or in the X-Omnis-Debug-Token header,
+// with the correlation ID in the X-Correlation-ID header
+func NewDebugToken(secret []byte, correlationID string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + debugSignature(secret, correlationID, expiry)
+}
+
+// debugSignature signs the correlation ID and expiry
+func debugSignature(secret []byte, correlationID string, expiry string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(correlationID + "." + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Authorized reports whether the request may use ?debug
+func (p *DebugPolicy) Authorized(c *gin.Context) bool {
+	if p == nil || c == nil {
+		return false
+	}
+
+	if p.validToken(c) || p.allowedIP(p.clientIP(c)) {
+		return true
+	}
+
+	return p.Authorizer != nil && p.Authorizer(c)
+}
+
+// validToken checks the request's debug token against its correlation ID
+func (p *DebugPolicy) validToken(c *gin.Context) bool {
+	if len(p.Secret) == 0 {
+		return false
+	}
+
+	token := c.GetHeader(DEBUG_TOKEN_HEADER)
+	if token == "" {
+		token = c.Query("debug")
+	}
+
+	expiry, signature, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	correlationID := c.GetString(CORRELATION_ID_KEY)
+	if correlationID == "" {
+		return false
+	}
+
+	expected := debugSignature(p.Secret, correlationID, expiry)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// clientIP returns the direct peer's IP, or the forwarded client IP when the peer is a trusted proxy
+// gin's c.ClientIP() is not used, since gin trusts every proxy by default and X-Forwarded-For is easily spoofed
+// X-Forwarded-For is read from the right, skipping trusted proxies, so a client cannot prepend a forged IP
+func (p *DebugPolicy) clientIP(c *gin.Context) string {
+	remoteIP := c.RemoteIP()
+	if len(p.TrustedProxies) == 0 || !ipAllowed(remoteIP, p.TrustedProxies) {
+		return remoteIP
+	}
+
+	forwarded := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+	clientIP := remoteIP
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		clientIP = ip
+		if !ipAllowed(ip, p.TrustedProxies) {
+			break
+		}
+	}
+	return clientIP
+}
+
+// allowedIP checks the client IP against the allowed IPs and CIDR ranges
+func (p *DebugPolicy) allowedIP(clientIP string) bool {
+	return ipAllowed(clientIP, p.AllowedIPs)
+}
+
+// ipAllowed checks an IP against a list of IPs and CIDR ranges
+func ipAllowed(clientIP string, allowedIPs []string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, allowed := range allowedIPs {
+		if strings.Contains(allowed, "/") {
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+// -----------------------------------------------------------------------
+// Debug Policy Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("debug-secret")
+
+	newRouter := func(scope string, policy *DebugPolicy) *gin.Engine {
+		return newTestRouter(nil, &JSONRendererConfig{
+			ServiceConfig:  &ServiceConfig{Name: "test-service", Version: "1.0.0", Scope: scope},
+			ResponseFormat: FORMAT_STANDARD,
+			DebugPolicy:    policy,
+		}, "/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "hello"})
+		})
+	}
+
+	// enveloped reports whether the debug envelope was rendered
+	enveloped := func(r *gin.Engine, target string, options ...requestOption) bool {
+		options = append([]requestOption{withRemoteAddr("203.0.113.7:4321"), withHeader("X-Correlation-ID", "debug-test")}, options...)
+		response := decodeTestResponse[map[string]interface{}](t, serveTestRequest(r, target, options...))
+		_, ok := response["correlationid"]
+		return ok
+	}
+
+	t.Run("Always Allowed In DEV", func(t *testing.T) {
+		assert.True(t, enveloped(newRouter("DEV", nil), "/test?debug"))
+	})
+
+	t.Run("Ignored Outside DEV Without Policy", func(t *testing.T) {
+		assert.False(t, enveloped(newRouter("PRD", nil), "/test?debug"))
+		assert.False(t, enveloped(newRouter("PRD", nil), "/test?debug="+NewDebugToken(secret, "debug-test", time.Now().Add(time.Minute))))
+	})
+
+	t.Run("Signed Token", func(t *testing.T) {
+		r := newRouter("PRD", &DebugPolicy{Secret: secret})
+		token := NewDebugToken(secret, "debug-test", time.Now().Add(time.Minute))
+
+		assert.True(t, enveloped(r, "/test?debug="+token))
+		assert.True(t, enveloped(r, "/test?debug", withHeader(DEBUG_TOKEN_HEADER, token)))
+		assert.False(t, enveloped(r, "/test?debug"))
+		assert.False(t, enveloped(r, "/test", withHeader(DEBUG_TOKEN_HEADER, token)))
+	})
+
+	t.Run("Rejected Tokens", func(t *testing.T) {
+		r := newRouter("PRD", &DebugPolicy{Secret: secret})
+
+		expired := NewDebugToken(secret, "debug-test", time.Now().Add(-time.Minute))
+		otherID := NewDebugToken(secret, "other-id", time.Now().Add(time.Minute))
+		otherSecret := NewDebugToken([]byte("wrong"), "debug-test", time.Now().Add(time.Minute))
+		valid := NewDebugToken(secret, "debug-test", time.Now().Add(time.Minute))
+		_, signature, _ := strings.Cut(valid, ".")
+		extended := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "." + signature
+
+		for _, token := range []string{expired, otherID, otherSecret, extended, "garbage", "123.abc"} {
+			assert.False(t, enveloped(r, "/test?debug="+token), token)
+		}
+	})
+
+	t.Run("Allowed IPs", func(t *testing.T) {
+		assert.True(t, enveloped(newRouter("PRD", &DebugPolicy{AllowedIPs: []string{"203.0.113.7"}}), "/test?debug"))
+		assert.True(t, enveloped(newRouter("PRD", &DebugPolicy{AllowedIPs: []string{"10.0.0.0/8", "203.0.113.0/24"}}), "/test?debug"))
+		assert.False(t, enveloped(newRouter("PRD", &DebugPolicy{AllowedIPs: []string{"10.0.0.0/8", "invalid"}}), "/test?debug"))
+	})
+
+	t.Run("Forwarded IPs Only From Trusted Proxies", func(t *testing.T) {
+		forwarded := withHeader("X-Forwarded-For", "10.1.2.3")
+
+		// A client cannot claim an allowed IP by sending X-Forwarded-For itself
+		r := newRouter("PRD", &DebugPolicy{AllowedIPs: []string{"10.0.0.0/8"}})
+		assert.False(t, enveloped(r, "/test?debug", withRemoteAddr("198.51.100.9:4321"), forwarded))
+
+		r = newRouter("PRD", &DebugPolicy{AllowedIPs: []string{"10.0.0.0/8"}, TrustedProxies: []string{"192.168.0.1"}})
+		assert.False(t, enveloped(r, "/test?debug", withRemoteAddr("198.51.100.9:4321"), forwarded))
+		assert.True(t, enveloped(r, "/test?debug", withRemoteAddr("192.168.0.1:4321"), forwarded))
+		// Only the entry appended by the trusted proxy counts, not one the client prepended
+		assert.False(t, enveloped(r, "/test?debug", withRemoteAddr("192.168.0.1:4321"), withHeader("X-Forwarded-For", "10.1.2.3, 198.51.100.9")))
+	})
+
+	t.Run("Ignored Without A Scope", func(t *testing.T) {
+		assert.False(t, enveloped(newRouter("", nil), "/test?debug"))
+	})
+
+	t.Run("Authorizer", func(t *testing.T) {
+		r := newRouter("PRD", &DebugPolicy{
+			Authorizer: func(c *gin.Context) bool { return c.GetHeader("X-Role") == "admin" },
+		})
+
+		assert.True(t, enveloped(r, "/test?debug", withHeader("X-Role", "admin")))
+		assert.False(t, enveloped(r, "/test?debug", withHeader("X-Role", "user")))
+	})
+}
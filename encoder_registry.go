@@ -0,0 +1,254 @@
+// -----------------------------------------------------------------------
+// Encoder Registry
+// Content negotiation between the Accept header and envelope encoders
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncoderRegistry holds the encoders available for content negotiation
+type EncoderRegistry struct {
+	mu       sync.RWMutex
+	encoders []IEncoder
+}
+
+// xhtmlMediaType is not matched to the XML encoder by its +xml suffix
+const xhtmlMediaType = "application/xhtml+xml"
+
+// defaultEncoders is used when JSONRendererConfig.Encoders is not set
+var defaultEncoders = DefaultEncoderRegistry()
+
+// NewEncoderRegistry creates a registry with the given encoders, in order of preference
+func NewEncoderRegistry(encoders ...IEncoder) *EncoderRegistry {
+	registry := &EncoderRegistry{}
+	for _, encoder := range encoders {
+		registry.Register(encoder)
+	}
+	return registry
+}
+
+// DefaultEncoderRegistry creates a registry with the built-in JSON, XML, YAML, MessagePack and CBOR encoders
+func DefaultEncoderRegistry() *EncoderRegistry {
+	return NewEncoderRegistry(JSONEncoder(), XMLEncoder(), YAMLEncoder(), MsgpackEncoder(), CBOREncoder())
+}
+
+// RegisterEncoder adds an encoder to the default registry
+// Usage: omnis.RegisterEncoder(myTomlEncoder)
+func RegisterEncoder(encoder IEncoder) {
+	defaultEncoders.Register(encoder)
+}
+
+// Register adds an encoder, replacing any encoder with the same canonical media type
+func (r *EncoderRegistry) Register(encoder IEncoder) {
+	if encoder == nil || len(encoder.MediaTypes()) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mediaType := strings.ToLower(encoder.MediaTypes()[0])
+	for i, existing := range r.encoders {
+		if strings.ToLower(existing.MediaTypes()[0]) == mediaType {
+			r.encoders[i] = encoder
+			return
+		}
+	}
+	r.encoders = append(r.encoders, encoder)
+}
+
+// MediaTypes returns the canonical media type of each registered encoder
+func (r *EncoderRegistry) MediaTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mediaTypes := make([]string, 0, len(r.encoders))
+	for _, encoder := range r.encoders {
+		mediaTypes = append(mediaTypes, encoder.MediaTypes()[0])
+	}
+	return mediaTypes
+}
+
+// Lookup returns the encoder serving the media type, or nil
+// Structured syntax suffixes (RFC 6839) such as application/hal+json match the base format,
+// except for XHTML, which browsers ask for as a page rather than as XML data
+func (r *EncoderRegistry) Lookup(mediaType string) IEncoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mediaType = strings.ToLower(mediaType)
+	if encoder := r.lookup(mediaType); encoder != nil {
+		return encoder
+	}
+
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 && mediaType != xhtmlMediaType {
+		return r.lookup("application/" + mediaType[i+1:])
+	}
+	return nil
+}
+
+// lookup finds an exact media type match, the caller holds the lock
+func (r *EncoderRegistry) lookup(mediaType string) IEncoder {
+	for _, encoder := range r.encoders {
+		for _, candidate := range encoder.MediaTypes() {
+			if strings.ToLower(candidate) == mediaType {
+				return encoder
+			}
+		}
+	}
+	return nil
+}
+
+// Negotiate selects the encoder for an Accept header
+// preferred is the media type of the response body, used when the client accepts anything, or when
+// the client's first choice cannot be served but the body's type is accepted, as with browsers
+// asking for text/html. It returns false when no registered encoder is acceptable
+func (r *EncoderRegistry) Negotiate(accept string, preferred string) (IEncoder, bool) {
+	fallback := r.Lookup(preferred)
+	if fallback == nil {
+		r.mu.RLock()
+		if len(r.encoders) > 0 {
+			fallback = r.encoders[0]
+		}
+		r.mu.RUnlock()
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return fallback, fallback != nil
+	}
+
+	mediaRanges := parseAccept(accept)
+	if len(mediaRanges) > 0 && fallback != nil && r.serve(mediaRanges[0], fallback) == nil &&
+		acceptsMediaType(accept, strings.ToLower(fallback.MediaTypes()[0])) {
+		return fallback, true
+	}
+
+	for _, mediaRange := range mediaRanges {
+		if encoder := r.serve(mediaRange, fallback); encoder != nil {
+			return encoder, true
+		}
+	}
+
+	return nil, false
+}
+
+// serve returns the encoder for a media range, or nil
+func (r *EncoderRegistry) serve(mediaRange string, fallback IEncoder) IEncoder {
+	switch {
+	case mediaRange == "*/*":
+		return fallback
+	case strings.HasSuffix(mediaRange, "/*"):
+		return r.matchType(strings.TrimSuffix(mediaRange, "*"), fallback)
+	}
+	return r.Lookup(mediaRange)
+}
+
+// matchType finds an encoder for a type/* media range, favouring the fallback encoder
+func (r *EncoderRegistry) matchType(prefix string, fallback IEncoder) IEncoder {
+	if fallback != nil && servesType(fallback, prefix) {
+		return fallback
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, encoder := range r.encoders {
+		if servesType(encoder, prefix) {
+			return encoder
+		}
+	}
+	return nil
+}
+
+// servesType reports whether any of the encoder's media types start with the type prefix
+func servesType(encoder IEncoder, prefix string) bool {
+	for _, mediaType := range encoder.MediaTypes() {
+		if strings.HasPrefix(strings.ToLower(mediaType), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsMediaType reports whether the Accept header explicitly or by wildcard allows the media type
+func acceptsMediaType(accept string, mediaType string) bool {
+	if mediaType == "" {
+		return false
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		if mediaRange == "*/*" || mediaRange == mediaType ||
+			(strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptRange is a single media range of an Accept header
+type acceptRange struct {
+	mediaType   string
+	quality     float64
+	specificity int
+}
+
+// parseAccept returns the acceptable media ranges, best first
+// Ranges are ordered by quality, then specificity, then header order; q=0 ranges are dropped
+func parseAccept(accept string) []string {
+	ranges := []acceptRange{}
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.TrimSpace(key) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		specificity := 2
+		if mediaType == "*/*" || mediaType == "*" {
+			mediaType = "*/*"
+			specificity = 0
+		} else if strings.HasSuffix(mediaType, "/*") {
+			specificity = 1
+		}
+
+		ranges = append(ranges, acceptRange{mediaType: mediaType, quality: quality, specificity: specificity})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].quality != ranges[j].quality {
+			return ranges[i].quality > ranges[j].quality
+		}
+		return ranges[i].specificity > ranges[j].specificity
+	})
+
+	mediaTypes := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		mediaTypes = append(mediaTypes, r.mediaType)
+	}
+	return mediaTypes
+}
+
+// mediaType returns the lower-cased media type of a Content-Type header, without parameters
+func mediaType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
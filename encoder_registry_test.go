@@ -0,0 +1,63 @@
+// -----------------------------------------------------------------------
+// Encoder Registry Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderRegistry(t *testing.T) {
+	registry := DefaultEncoderRegistry()
+
+	negotiate := func(accept string, preferred string) string {
+		encoder, ok := registry.Negotiate(accept, preferred)
+		if !ok {
+			return ""
+		}
+		return encoder.MediaTypes()[0]
+	}
+
+	t.Run("Empty Accept Uses Body Format", func(t *testing.T) {
+		assert.Equal(t, XML_CONTENT_TYPE, negotiate("", "text/xml"))
+		assert.Equal(t, JSON_CONTENT_TYPE, negotiate("", PROTOBUF_CONTENT_TYPE))
+	})
+
+	t.Run("Quality And Specificity", func(t *testing.T) {
+		assert.Equal(t, YAML_CONTENT_TYPE, negotiate("application/xml;q=0.5, application/yaml", JSON_CONTENT_TYPE))
+		assert.Equal(t, CBOR_CONTENT_TYPE, negotiate("*/*, application/cbor", JSON_CONTENT_TYPE))
+		assert.Equal(t, JSON_CONTENT_TYPE, negotiate("*/*;q=0.8, text/html", JSON_CONTENT_TYPE))
+		assert.Equal(t, XML_CONTENT_TYPE, negotiate("text/*", "text/xml"))
+		assert.Equal(t, JSON_CONTENT_TYPE, negotiate("application/*", JSON_CONTENT_TYPE))
+	})
+
+	t.Run("Aliases And Suffixes", func(t *testing.T) {
+		assert.Equal(t, MSGPACK_CONTENT_TYPE, negotiate("application/x-msgpack", JSON_CONTENT_TYPE))
+		assert.Equal(t, JSON_CONTENT_TYPE, negotiate("application/hal+json", XML_CONTENT_TYPE))
+		assert.Equal(t, JSON_CONTENT_TYPE, negotiate(PROBLEM_CONTENT_TYPE, JSON_CONTENT_TYPE))
+		assert.Equal(t, "", negotiate("application/xhtml+xml", JSON_CONTENT_TYPE))
+	})
+
+	t.Run("Unservable First Choice Keeps Body Format", func(t *testing.T) {
+		browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+		assert.Equal(t, JSON_CONTENT_TYPE, negotiate(browser, JSON_CONTENT_TYPE))
+		assert.Equal(t, YAML_CONTENT_TYPE, negotiate(browser, YAML_CONTENT_TYPE))
+		assert.Equal(t, XML_CONTENT_TYPE, negotiate("text/html, application/xml", JSON_CONTENT_TYPE))
+	})
+
+	t.Run("No Match", func(t *testing.T) {
+		assert.Equal(t, "", negotiate("text/html", JSON_CONTENT_TYPE))
+		assert.Equal(t, "", negotiate("application/json;q=0", JSON_CONTENT_TYPE))
+	})
+
+	t.Run("Register Replaces Canonical Media Type", func(t *testing.T) {
+		registry := NewEncoderRegistry(JSONEncoder(), XMLEncoder())
+		registry.Register(testTextEncoder{})
+		registry.Register(XMLEncoder())
+
+		assert.Equal(t, []string{JSON_CONTENT_TYPE, XML_CONTENT_TYPE, "text/plain"}, registry.MediaTypes())
+	})
+}
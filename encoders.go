@@ -0,0 +1,489 @@
+// -----------------------------------------------------------------------
+// Envelope Encoders
+// Built-in JSON, XML, YAML, MessagePack and CBOR envelope encoders, and
+// decoding of handler bodies rendered in those formats
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
+)
+
+// errUnsupportedBody is returned for response bodies the interceptor cannot decode
+var errUnsupportedBody = errors.New("unsupported response body media type")
+
+var (
+	msgpackHandle = newMsgpackHandle()
+	cborHandle    = newCborHandle()
+)
+
+func newMsgpackHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{WriteExt: true}
+	handle.RawToString = true
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return handle
+}
+
+func newCborHandle() *codec.CborHandle {
+	handle := &codec.CborHandle{}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return handle
+}
+
+// JSONEncoder returns the built-in JSON encoder, which also serves problem+json and JSON:API
+func JSONEncoder() IEncoder { return jsonEncoder{} }
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string { return "application/json; charset=utf-8" }
+
+func (jsonEncoder) MediaTypes() []string {
+	return []string{JSON_CONTENT_TYPE, PROBLEM_CONTENT_TYPE, JSONAPI_CONTENT_TYPE, "text/json"}
+}
+
+// Marshal encodes without escaping HTML; JSONMiddleware uses its configured JSONEncoder instead
+func (jsonEncoder) Marshal(v interface{}) ([]byte, error) { return stdJSON{}.Marshal(v, false) }
+
+// XMLEncoder returns the built-in XML encoder
+// The envelope is written as a <response> element with one child element per json field
+// Array items are written as <item> elements, and keys that are not valid XML names as <entry key="...">
+func XMLEncoder() IEncoder { return xmlEncoder{} }
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) ContentType() string { return "application/xml; charset=utf-8" }
+
+func (xmlEncoder) MediaTypes() []string { return []string{XML_CONTENT_TYPE, "text/xml"} }
+
+func (xmlEncoder) Marshal(v interface{}) ([]byte, error) {
+	value, err := orderedValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	encoder := xml.NewEncoder(&output)
+	if err := writeXML(encoder, xml.StartElement{Name: xml.Name{Local: "response"}}, value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// YAMLEncoder returns the built-in YAML encoder
+func YAMLEncoder() IEncoder { return yamlEncoder{} }
+
+type yamlEncoder struct{}
+
+func (yamlEncoder) ContentType() string { return "application/yaml; charset=utf-8" }
+
+func (yamlEncoder) MediaTypes() []string {
+	return []string{YAML_CONTENT_TYPE, "application/x-yaml", "text/yaml"}
+}
+
+func (yamlEncoder) Marshal(v interface{}) ([]byte, error) {
+	value, err := orderedValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(yamlNode(value))
+}
+
+// MsgpackEncoder returns the built-in MessagePack encoder
+func MsgpackEncoder() IEncoder {
+	return binaryEncoder{handle: msgpackHandle, mediaTypes: []string{MSGPACK_CONTENT_TYPE, "application/x-msgpack"}}
+}
+
+// CBOREncoder returns the built-in CBOR encoder
+func CBOREncoder() IEncoder {
+	return binaryEncoder{handle: cborHandle, mediaTypes: []string{CBOR_CONTENT_TYPE}}
+}
+
+// binaryEncoder encodes the envelope with a ugorji codec handle
+type binaryEncoder struct {
+	handle     codec.Handle
+	mediaTypes []string
+}
+
+func (e binaryEncoder) ContentType() string { return e.mediaTypes[0] }
+
+func (e binaryEncoder) MediaTypes() []string { return e.mediaTypes }
+
+func (e binaryEncoder) Marshal(v interface{}) ([]byte, error) {
+	value, err := orderedValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var output []byte
+	if err := codec.NewEncoderBytes(&output, e.handle).Encode(binaryValue(value)); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// orderedMap is a JSON object decoded as alternating keys and values, keeping key order
+// It encodes as an object in JSON and as a map in MessagePack and CBOR
+type orderedMap []interface{}
+
+// MapBySlice marks the slice as a map for the ugorji codecs
+func (orderedMap) MapBySlice() {}
+
+// MarshalJSON writes the members as a JSON object in their original order, without escaping HTML
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var output bytes.Buffer
+	output.WriteByte('{')
+	for i := 0; i+1 < len(m); i += 2 {
+		if i > 0 {
+			output.WriteByte(',')
+		}
+		key, err := stdJSON{}.Marshal(m[i], false)
+		if err != nil {
+			return nil, err
+		}
+		value, err := stdJSON{}.Marshal(m[i+1], false)
+		if err != nil {
+			return nil, err
+		}
+		output.Write(key)
+		output.WriteByte(':')
+		output.Write(value)
+	}
+	output.WriteByte('}')
+	return output.Bytes(), nil
+}
+
+// orderedValue converts a value to its JSON form decoded as ordered maps, slices and scalars
+// Encoders work from this form so json tags, field order and number text are respected
+func orderedValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeOrdered(data)
+}
+
+// decodeOrdered decodes JSON into orderedMap, []interface{}, string, json.Number, bool and nil values
+func decodeOrdered(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return readOrdered(decoder)
+}
+
+func readOrdered(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	if delim == '{' {
+		object := orderedMap{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, key, value)
+		}
+		_, err := decoder.Token()
+		return object, err
+	}
+
+	array := []interface{}{}
+	for decoder.More() {
+		value, err := readOrdered(decoder)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+	_, err = decoder.Token()
+	return array, err
+}
+
+// binaryValue converts json.Number values to integers or floats for the binary codecs
+func binaryValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case orderedMap:
+		converted := make(orderedMap, len(v))
+		for i := range v {
+			converted[i] = binaryValue(v[i])
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i := range v {
+			converted[i] = binaryValue(v[i])
+		}
+		return converted
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if n, err := v.Float64(); err == nil {
+			return n
+		}
+		return v.String()
+	}
+	return value
+}
+
+// writeXML writes the value as an element, recursing into objects and arrays
+func writeXML(encoder *xml.Encoder, start xml.StartElement, value interface{}) error {
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case orderedMap:
+		for i := 0; i+1 < len(v); i += 2 {
+			if err := writeXML(encoder, xmlElement(fmt.Sprint(v[i])), v[i+1]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXML(encoder, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlElement returns the element for an object key
+func xmlElement(key string) xml.StartElement {
+	if isXMLName(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "entry"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+	}
+}
+
+// isXMLName reports whether the key can be used as an element name as-is
+func isXMLName(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// yamlNode converts an ordered value to a YAML node, keeping key order and number text
+func yamlNode(value interface{}) *yaml.Node {
+	switch v := value.(type) {
+	case orderedMap:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for i := 0; i+1 < len(v); i += 2 {
+			node.Content = append(node.Content, yamlNode(fmt.Sprint(v[i])), yamlNode(v[i+1]))
+		}
+		return node
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(v)}
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(value)}
+}
+
+// canDecodeBody reports whether the interceptor can decode a body of the media type into a result
+func canDecodeBody(mediaType string) bool {
+	switch mediaType {
+	case JSON_CONTENT_TYPE, XML_CONTENT_TYPE, "text/xml", YAML_CONTENT_TYPE, "application/x-yaml",
+		MSGPACK_CONTENT_TYPE, "application/x-msgpack", CBOR_CONTENT_TYPE, PROTOBUF_CONTENT_TYPE:
+		return true
+	}
+	return false
+}
+
+// decodeBody decodes a handler body into a result value that can be JSON encoded
+// Protocol buffers are opaque without their schema and are kept as bytes
+func decodeBody(mediaType string, data []byte) (interface{}, error) {
+	switch mediaType {
+	case JSON_CONTENT_TYPE:
+		body := bytes.TrimSpace(data)
+		if !json.Valid(body) {
+			return nil, errors.New("invalid JSON body")
+		}
+		return json.RawMessage(body), nil
+	case XML_CONTENT_TYPE, "text/xml":
+		return decodeXML(data)
+	case YAML_CONTENT_TYPE, "application/x-yaml":
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		return yamlValue(&node)
+	case MSGPACK_CONTENT_TYPE, "application/x-msgpack":
+		return decodeBinary(data, msgpackHandle)
+	case CBOR_CONTENT_TYPE:
+		return decodeBinary(data, cborHandle)
+	case PROTOBUF_CONTENT_TYPE:
+		return data, nil
+	}
+	return nil, errUnsupportedBody
+}
+
+// decodeBinary decodes a MessagePack or CBOR body
+func decodeBinary(data []byte, handle codec.Handle) (interface{}, error) {
+	var value interface{}
+	if err := codec.NewDecoderBytes(data, handle).Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// yamlValue converts a decoded YAML node, keeping mapping key order
+func yamlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.MappingNode:
+		object := orderedMap{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := yamlValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, node.Content[i].Value, value)
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		array := []interface{}{}
+		for _, item := range node.Content {
+			value, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	}
+
+	var value interface{}
+	err := node.Decode(&value)
+	return value, err
+}
+
+// decodeXML decodes an XML body into ordered maps of its root element's children
+// Attributes become "@name" members, repeated elements become arrays and text-only elements strings
+func decodeXML(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return readXML(decoder, start)
+		}
+	}
+}
+
+func readXML(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	object := orderedMap{}
+	for _, attr := range start.Attr {
+		object = append(object, "@"+attr.Name.Local, attr.Value)
+	}
+
+	var text strings.Builder
+	children := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			children = true
+			value, err := readXML(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			object = object.add(t.Name.Local, value)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if !children && len(object) == 0 {
+				return strings.TrimSpace(text.String()), nil
+			}
+			return object, nil
+		}
+	}
+}
+
+// add appends a member, collecting repeated keys into an array
+func (m orderedMap) add(key string, value interface{}) orderedMap {
+	for i := 0; i+1 < len(m); i += 2 {
+		if m[i] != key {
+			continue
+		}
+		if array, ok := m[i+1].([]interface{}); ok {
+			m[i+1] = append(array, value)
+		} else {
+			m[i+1] = []interface{}{m[i+1], value}
+		}
+		return m
+	}
+	return append(m, key, value)
+}
@@ -0,0 +1,165 @@
+// -----------------------------------------------------------------------
+// ID Generators
+// Built-in UUIDv4, UUIDv7, ULID, KSUID, snowflake and sequential
+// correlation ID generators
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Encoding alphabets for ULIDs (Crockford's base32) and KSUIDs (base62)
+const (
+	CROCKFORD_ALPHABET = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	BASE62_ALPHABET    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// KSUID_EPOCH is the KSUID epoch in Unix seconds (2014-05-13)
+const KSUID_EPOCH = 1400000000
+
+// Snowflake IDs are a 41-bit millisecond timestamp, a 10-bit node and a 12-bit sequence
+const (
+	SNOWFLAKE_EPOCH         = 1288834974657 // Milliseconds since the Unix epoch (2010-11-04), as Twitter's
+	SNOWFLAKE_MAX_NODE      = 1023
+	SNOWFLAKE_SEQUENCE_MASK = 4095
+)
+
+// newCorrelationID generates a correlation ID, falling back to a UUIDv4 if the generator fails
+func newCorrelationID(generator IGenerator) string {
+	if generator != nil {
+		if id, err := generator.Generate(); err == nil && id != "" {
+			return id
+		}
+	}
+	return uuid.New().String()
+}
+
+// UUIDv4Generator generates random UUIDs, the default
+func UUIDv4Generator() IGenerator { return uuidV4Generator{} }
+
+type uuidV4Generator struct{}
+
+func (uuidV4Generator) Generate() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// UUIDv7Generator generates time-ordered UUIDs, which sort by creation time to the millisecond
+func UUIDv7Generator() IGenerator { return uuidV7Generator{} }
+
+type uuidV7Generator struct{}
+
+func (uuidV7Generator) Generate() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// ULIDGenerator generates 26 character ULIDs, which sort by creation time to the millisecond
+func ULIDGenerator() IGenerator { return ulidGenerator{} }
+
+type ulidGenerator struct{}
+
+func (ulidGenerator) Generate() (string, error) {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[0:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	return encodeID(id[:], CROCKFORD_ALPHABET, 26), nil
+}
+
+// KSUIDGenerator generates 27 character KSUIDs, which sort by creation time to the second
+func KSUIDGenerator() IGenerator { return ksuidGenerator{} }
+
+type ksuidGenerator struct{}
+
+func (ksuidGenerator) Generate() (string, error) {
+	var id [20]byte
+	binary.BigEndian.PutUint32(id[0:4], uint32(time.Now().Unix()-KSUID_EPOCH))
+	if _, err := rand.Read(id[4:]); err != nil {
+		return "", err
+	}
+	return encodeID(id[:], BASE62_ALPHABET, 27), nil
+}
+
+// encodeID encodes the bytes as a big-endian number in the alphabet, left-padded to width
+func encodeID(id []byte, alphabet string, width int) string {
+	n := new(big.Int).SetBytes(id)
+	base := big.NewInt(int64(len(alphabet)))
+	digit := new(big.Int)
+
+	encoded := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		encoded[i] = alphabet[digit.Int64()]
+	}
+	return string(encoded)
+}
+
+// SnowflakeGenerator generates decimal snowflake IDs for a node from 0 to SNOWFLAKE_MAX_NODE
+// IDs are unique across nodes and increase on each node, even if the clock moves backwards
+// Usage: generator, err := omnis.SnowflakeGenerator(node)
+func SnowflakeGenerator(node int64) (IGenerator, error) {
+	if node < 0 || node > SNOWFLAKE_MAX_NODE {
+		return nil, fmt.Errorf("snowflake node %d is outside 0-%d", node, SNOWFLAKE_MAX_NODE)
+	}
+	return &snowflakeGenerator{node: node}, nil
+}
+
+type snowflakeGenerator struct {
+	node     int64
+	mutex    sync.Mutex
+	last     int64 // Timestamp of the last ID
+	sequence int64 // Sequence of the last ID within its timestamp
+}
+
+func (g *snowflakeGenerator) Generate() (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := time.Now().UnixMilli() - SNOWFLAKE_EPOCH
+	if now <= g.last {
+		// Same millisecond, or the clock moved backwards: continue from the last ID,
+		// borrowing the next millisecond when the sequence is exhausted
+		now = g.last
+		g.sequence = (g.sequence + 1) & SNOWFLAKE_SEQUENCE_MASK
+		if g.sequence == 0 {
+			now++
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.last = now
+
+	return strconv.FormatInt(now<<22|g.node<<12|g.sequence, 10), nil
+}
+
+// SequentialGenerator generates deterministic IDs for tests: the prefix and a six digit sequence from 1,
+// e.g. "test-000001"
+func SequentialGenerator(prefix string) IGenerator { return &sequentialGenerator{prefix: prefix} }
+
+type sequentialGenerator struct {
+	prefix string
+	next   atomic.Uint64
+}
+
+func (g *sequentialGenerator) Generate() (string, error) {
+	return fmt.Sprintf("%s%06d", g.prefix, g.next.Add(1)), nil
+}
@@ -0,0 +1,214 @@
+// -----------------------------------------------------------------------
+// ID Generator Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerators(t *testing.T) {
+	generate := func(t *testing.T, generator IGenerator, count int) []string {
+		ids := make([]string, count)
+		for i := range ids {
+			id, err := generator.Generate()
+			require.NoError(t, err)
+			ids[i] = id
+		}
+		return ids
+	}
+
+	snowflake, err := SnowflakeGenerator(1)
+	require.NoError(t, err)
+
+	formats := map[string]struct {
+		generator IGenerator
+		pattern   string
+	}{
+		"UUIDv4":    {UUIDv4Generator(), `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		"UUIDv7":    {UUIDv7Generator(), `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		"ULID":      {ULIDGenerator(), `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		"KSUID":     {KSUIDGenerator(), `^[0-9A-Za-z]{27}$`},
+		"Snowflake": {snowflake, `^[1-9][0-9]{17,18}$`},
+	}
+	for name, format := range formats {
+		t.Run(name, func(t *testing.T) {
+			ids := generate(t, format.generator, 1000)
+
+			unique := map[string]bool{}
+			for _, id := range ids {
+				assert.Regexp(t, regexp.MustCompile(format.pattern), id)
+				unique[id] = true
+			}
+			assert.Len(t, unique, len(ids))
+		})
+	}
+
+	t.Run("Time Ordered", func(t *testing.T) {
+		for _, generator := range []IGenerator{UUIDv7Generator(), ULIDGenerator()} {
+			first := generate(t, generator, 1)[0]
+			time.Sleep(2 * time.Millisecond)
+			second := generate(t, generator, 1)[0]
+			assert.Less(t, first, second)
+		}
+	})
+
+	t.Run("ULID Timestamp", func(t *testing.T) {
+		id := generate(t, ULIDGenerator(), 1)[0]
+
+		// The first 10 characters encode the 48-bit millisecond timestamp
+		var ms int64
+		for _, c := range id[:10] {
+			ms = ms*32 + int64(strings.IndexRune(CROCKFORD_ALPHABET, c))
+		}
+		assert.WithinDuration(t, time.Now(), time.UnixMilli(ms), time.Second)
+	})
+
+	t.Run("KSUID Encoding", func(t *testing.T) {
+		max := make([]byte, 20)
+		for i := range max {
+			max[i] = 0xff
+		}
+		// The largest KSUID fits in 27 characters, and the smallest is zero padded
+		assert.Equal(t, "aWgEPTl1tmebfsQzFP4bxwgy80V", encodeID(max, BASE62_ALPHABET, 27))
+		assert.Equal(t, "000000000000000000000000001", encodeID([]byte{1}, BASE62_ALPHABET, 27))
+	})
+
+	t.Run("Snowflake", func(t *testing.T) {
+		generator, err := SnowflakeGenerator(42)
+		require.NoError(t, err)
+
+		var mutex sync.Mutex
+		var ids []int64
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, id := range generate(t, generator, 1000) {
+					value, err := strconv.ParseInt(id, 10, 64)
+					require.NoError(t, err)
+					mutex.Lock()
+					ids = append(ids, value)
+					mutex.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		unique := map[int64]bool{}
+		for _, id := range ids {
+			assert.Equal(t, int64(42), id>>12&SNOWFLAKE_MAX_NODE)
+			unique[id] = true
+		}
+		assert.Len(t, unique, 8000)
+
+		// IDs increase on a node
+		sequential := generate(t, generator, 100)
+		assert.True(t, sort.SliceIsSorted(sequential, func(i, j int) bool {
+			a, _ := strconv.ParseInt(sequential[i], 10, 64)
+			b, _ := strconv.ParseInt(sequential[j], 10, 64)
+			return a < b
+		}))
+
+		// Nodes out of range are rejected when the generator is created
+		_, err = SnowflakeGenerator(SNOWFLAKE_MAX_NODE + 1)
+		assert.Error(t, err)
+		_, err = SnowflakeGenerator(-1)
+		assert.Error(t, err)
+	})
+
+	t.Run("Sequential", func(t *testing.T) {
+		assert.Equal(t, []string{"test-000001", "test-000002", "test-000003"}, generate(t, SequentialGenerator("test-"), 3))
+	})
+}
+
+// failingGenerator is a generator whose IDs cannot be generated
+type failingGenerator struct{}
+
+func (failingGenerator) Generate() (string, error) {
+	return "", errors.New("no entropy")
+}
+
+func TestCorrelationService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Generates With The Selected Generator", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+
+		service := CorrelationService(c).WithGenerator(SequentialGenerator("svc-"))
+		assert.Equal(t, "unknown", service.GetCorrelationID())
+
+		id, err := service.SetCorrelationID()
+		require.NoError(t, err)
+		assert.Equal(t, "svc-000001", id)
+		assert.Equal(t, "svc-000001", service.GetCorrelationID())
+		assert.Equal(t, "svc-000001", w.Header().Get("X-Correlation-ID"))
+
+		// An existing correlation ID is kept
+		id, err = service.SetCorrelationID()
+		require.NoError(t, err)
+		assert.Equal(t, "svc-000001", id)
+	})
+
+	t.Run("Defaults To UUIDv4", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+
+		id, err := CorrelationService(nil).WithContext(c).WithGenerator(nil).SetCorrelationID()
+		require.NoError(t, err)
+		parsed, err := uuid.Parse(id)
+		require.NoError(t, err)
+		assert.Equal(t, uuid.Version(4), parsed.Version())
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := CorrelationService(nil).SetCorrelationID()
+		assert.ErrorIs(t, err, errNoContext)
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		_, err = CorrelationService(c).WithGenerator(failingGenerator{}).SetCorrelationID()
+		assert.Error(t, err)
+		assert.Empty(t, c.GetString(CORRELATION_ID_KEY))
+	})
+
+	t.Run("Middleware Generator", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationIDWithConfig(&CorrelationConfig{Generator: SequentialGenerator("req-")}))
+		r.GET("/", func(c *gin.Context) {
+			c.String(http.StatusOK, GetCorrelationID(c))
+		})
+
+		for _, expected := range []string{"req-000001", "req-000002"} {
+			req, _ := http.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, expected, w.Body.String())
+			assert.Equal(t, expected, w.Header().Get("X-Correlation-ID"))
+		}
+
+		// IDs sent by the caller are still used
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Correlation-ID", "caller-id")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, "caller-id", w.Body.String())
+	})
+}
@@ -0,0 +1,163 @@
+// -----------------------------------------------------------------------
+// Gin Extensions
+// Fluent gin context wrapper for JSON responses with logging context
+// Created: 2025-08-27
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ternarybob/arbor"
+)
+
+// GinContext wraps a gin context with fluent JSON response helpers
+type GinContext struct {
+	ctx *gin.Context
+}
+
+// C wraps the gin context for fluent JSON responses
+// Usage: omnis.C(c).WithLogger(log).JSON(200, data)
+func C(c *gin.Context) *GinContext {
+	return &GinContext{
+		ctx: c,
+	}
+}
+
+// Chain is an alias of C
+// Usage: omnis.Chain(c).WithLogger(log).Created(data)
+func Chain(c *gin.Context) *GinContext {
+	return C(c)
+}
+
+// JSON is an alias of C
+// Usage: omnis.JSON(c).WithLogger(log).Success(data)
+func JSON(c *gin.Context) *GinContext {
+	return C(c)
+}
+
+// LoggerChain wraps the gin context with the logger already set
+// Usage: omnis.LoggerChain(c, log).Success(data)
+func LoggerChain(c *gin.Context, logger arbor.ILogger) *GinContext {
+	return C(c).WithLogger(logger)
+}
+
+// WithLogger stores the logger under REQUEST_LOGGER so its memory logs are included in the response,
+// and in the request's context for LoggerFromContext
+// Usage: omnis.WithLogger(c, log)
+func WithLogger(c *gin.Context, logger arbor.ILogger) {
+	if c == nil || logger == nil {
+		return
+	}
+	if buffer := GetLogBuffer(c); buffer != nil {
+		logger = buffer.bind(logger)
+	}
+	c.Set(REQUEST_LOGGER, logger)
+	setRequestContext(c, func(ctx context.Context) context.Context {
+		return ContextWithLogger(ctx, logger)
+	})
+}
+
+// GetRequestLogger returns the logger stored under REQUEST_LOGGER, or nil
+// Usage: log := omnis.GetRequestLogger(c)
+func GetRequestLogger(c *gin.Context) arbor.ILogger {
+	if c == nil {
+		return nil
+	}
+	if logger, ok := c.Value(REQUEST_LOGGER).(arbor.ILogger); ok {
+		return logger
+	}
+	return nil
+}
+
+// WithLogger sets the request logger for this context
+func (g *GinContext) WithLogger(logger arbor.ILogger) *GinContext {
+	WithLogger(g.ctx, logger)
+	return g
+}
+
+// Context returns the wrapped gin context
+func (g *GinContext) Context() *gin.Context {
+	return g.ctx
+}
+
+// JSON renders the object through the JSON envelope
+// When JSONMiddleware is not installed, the envelope is applied with the default configuration
+func (g *GinContext) JSON(code int, obj interface{}) {
+	if g.ctx == nil {
+		return
+	}
+
+	if _, ok := g.ctx.Writer.(*jsonResponseInterceptor); !ok {
+		interceptor := newJSONResponseInterceptor(g.ctx, nil)
+		g.ctx.Writer = interceptor
+		defer func() {
+			interceptor.finish()
+			g.ctx.Writer = interceptor.ResponseWriter
+		}()
+	}
+
+	setResponseValue(g.ctx, obj)
+	g.ctx.JSON(code, obj)
+}
+
+// Success renders a 200 OK response
+func (g *GinContext) Success(obj interface{}) {
+	g.JSON(http.StatusOK, obj)
+}
+
+// Created renders a 201 Created response
+func (g *GinContext) Created(obj interface{}) {
+	g.JSON(http.StatusCreated, obj)
+}
+
+// Accepted renders a 202 Accepted response
+func (g *GinContext) Accepted(obj interface{}) {
+	g.JSON(http.StatusAccepted, obj)
+}
+
+// NoContent renders a 204 No Content response without a body
+func (g *GinContext) NoContent() {
+	if g.ctx == nil {
+		return
+	}
+	g.ctx.Status(http.StatusNoContent)
+}
+
+// BadRequest renders a 400 Bad Request response
+func (g *GinContext) BadRequest(obj interface{}) {
+	g.JSON(http.StatusBadRequest, obj)
+}
+
+// Unauthorized renders a 401 Unauthorized response
+func (g *GinContext) Unauthorized(obj interface{}) {
+	g.JSON(http.StatusUnauthorized, obj)
+}
+
+// Forbidden renders a 403 Forbidden response
+func (g *GinContext) Forbidden(obj interface{}) {
+	g.JSON(http.StatusForbidden, obj)
+}
+
+// NotFound renders a 404 Not Found response
+func (g *GinContext) NotFound(obj interface{}) {
+	g.JSON(http.StatusNotFound, obj)
+}
+
+// Conflict renders a 409 Conflict response
+func (g *GinContext) Conflict(obj interface{}) {
+	g.JSON(http.StatusConflict, obj)
+}
+
+// Unprocessable renders a 422 Unprocessable Entity response
+func (g *GinContext) Unprocessable(obj interface{}) {
+	g.JSON(http.StatusUnprocessableEntity, obj)
+}
+
+// InternalServerError renders a 500 Internal Server Error response
+func (g *GinContext) InternalServerError(obj interface{}) {
+	g.JSON(http.StatusInternalServerError, obj)
+}
@@ -6,12 +6,14 @@
 package omnis
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/ternarybob/arbor"
 )
 
@@ -81,4 +83,83 @@ func TestGinExtensions(t *testing.T) {
 		// Just verify the response isn't empty
 		assert.NotEmpty(t, w.Body.String())
 	})
+
+	t.Run("Fluent Helpers", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(JSONMiddlewareWithDefaults())
+
+		log := arbor.GetLogger().WithPrefix("FluentHandler")
+
+		r.GET("/success", func(c *gin.Context) { LoggerChain(c, log).Success(gin.H{"user": "john"}) })
+		r.GET("/created", func(c *gin.Context) { Chain(c).WithLogger(log).Created(gin.H{"user": "john"}) })
+		r.GET("/bad-request", func(c *gin.Context) { C(c).WithLogger(log).BadRequest(gin.H{"error": "invalid input"}) })
+		r.GET("/not-found", func(c *gin.Context) { C(c).NotFound(gin.H{"error": "not found"}) })
+		r.GET("/conflict", func(c *gin.Context) { C(c).Conflict(gin.H{"error": "conflict"}) })
+		r.GET("/unprocessable", func(c *gin.Context) { C(c).Unprocessable(gin.H{"error": "unprocessable"}) })
+		r.GET("/no-content", func(c *gin.Context) { C(c).NoContent() })
+
+		expected := map[string]int{
+			"/success":       http.StatusOK,
+			"/created":       http.StatusCreated,
+			"/bad-request":   http.StatusBadRequest,
+			"/not-found":     http.StatusNotFound,
+			"/conflict":      http.StatusConflict,
+			"/unprocessable": http.StatusUnprocessableEntity,
+			"/no-content":    http.StatusNoContent,
+		}
+
+		for path, code := range expected {
+			req, _ := http.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, code, w.Code, path)
+
+			if code == http.StatusNoContent {
+				assert.Empty(t, w.Body.String())
+				continue
+			}
+
+			var response ApiResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), path)
+			assert.Equal(t, code, response.Status, path)
+			assert.NotEmpty(t, response.CorrelationId, path)
+		}
+	})
+
+	t.Run("WithLogger Sets Request Logger", func(t *testing.T) {
+		r := gin.New()
+		log := arbor.GetLogger().WithPrefix("FluentHandler")
+
+		var stored interface{}
+		r.GET("/test", func(c *gin.Context) {
+			C(c).WithLogger(log).Success(gin.H{"message": "ok"})
+			stored, _ = c.Get(REQUEST_LOGGER)
+		})
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, log, stored)
+	})
+
+	t.Run("Envelope Without Middleware", func(t *testing.T) {
+		r := gin.New()
+
+		r.GET("/test", func(c *gin.Context) {
+			C(c).Success(gin.H{"message": "no middleware"})
+		})
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, map[string]interface{}{"message": "no middleware"}, response.Result)
+	})
 }
@@ -0,0 +1,94 @@
+// -----------------------------------------------------------------------
+// Test Helpers
+// Router setup, requests and memory writers shared by the tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/writers"
+)
+
+// newTestRouter creates a gin engine with SetCorrelationIDWithConfig and, when config is set,
+// JSONMiddlewareWithConfig, serving the handler for GET requests to the path
+func newTestRouter(correlation *CorrelationConfig, config *JSONRendererConfig, path string, handler gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(SetCorrelationIDWithConfig(correlation))
+	if config != nil {
+		r.Use(JSONMiddlewareWithConfig(config))
+	}
+	if handler != nil {
+		r.GET(path, handler)
+	}
+	return r
+}
+
+// requestOption modifies a test request before it is served
+type requestOption func(req *http.Request)
+
+// withHeader sets a request header; empty values are not sent
+func withHeader(key string, value string) requestOption {
+	return func(req *http.Request) {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+}
+
+// withRemoteAddr sets the address of the direct peer
+func withRemoteAddr(remoteAddr string) requestOption {
+	return func(req *http.Request) {
+		req.RemoteAddr = remoteAddr
+	}
+}
+
+// withBody sends the body with the method
+func withBody(method string, body string) requestOption {
+	return func(req *http.Request) {
+		req.Method = method
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+}
+
+// serveTestRequest serves a GET request for the target, modified by the options, and returns the recorder
+func serveTestRequest(r http.Handler, target string, options ...requestOption) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, option := range options {
+		option(req)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// decodeTestResponse unmarshals the recorder's JSON body
+func decodeTestResponse[T any](t testing.TB, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var response T
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	return response
+}
+
+// useMemoryWriter registers the writer as arbor's memory writer for the test
+func useMemoryWriter(t testing.TB, writer writers.IWriter) {
+	previous := arbor.GetRegisteredWriter(arbor.WRITER_MEMORY)
+	arbor.RegisterWriter(arbor.WRITER_MEMORY, writer)
+	t.Cleanup(func() {
+		if previous != nil {
+			arbor.RegisterWriter(arbor.WRITER_MEMORY, previous)
+		} else {
+			arbor.UnregisterWriter(arbor.WRITER_MEMORY)
+		}
+	})
+}
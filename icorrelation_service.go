@@ -5,7 +5,8 @@ import (
 )
 
 type ICorrelationService interface {
-	WithContext(ctx gin.Context) ICorrelationService
+	WithContext(ctx *gin.Context) ICorrelationService
+	WithGenerator(generator IGenerator) ICorrelationService
 	SetCorrelationID() (string, error)
 	GetCorrelationID() string
 }
@@ -0,0 +1,9 @@
+package omnis
+
+// IEncoder renders the response envelope in a media type selected by the Accept header
+// The first media type is the canonical one; the rest are accepted aliases
+type IEncoder interface {
+	ContentType() string
+	MediaTypes() []string
+	Marshal(v interface{}) ([]byte, error)
+}
@@ -0,0 +1,7 @@
+package omnis
+
+// IGenerator generates correlation IDs for requests that did not send one
+// Generate must be safe for concurrent use
+type IGenerator interface {
+	Generate() (string, error)
+}
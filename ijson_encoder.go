@@ -0,0 +1,9 @@
+package omnis
+
+// IJSONEncoder is the JSON library used by the renderer to encode envelopes and probe response bodies
+// Marshal must not escape HTML, so spliced bodies keep the escaping of the handler's encoder
+type IJSONEncoder interface {
+	Marshal(v interface{}, indent bool) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	Valid(data []byte) bool
+}
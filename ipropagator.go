@@ -0,0 +1,17 @@
+package omnis
+
+import "net/http"
+
+// IPropagator reads and writes the correlation and trace context carried in request headers
+// Extract reports false when none of its headers are present and valid
+type IPropagator interface {
+	Extract(header http.Header) (PropagationContext, bool)
+	Inject(propagation PropagationContext, header http.Header)
+}
+
+// PropagationContext is the correlation ID and trace context passed between services
+// On extraction Trace.SpanID is the caller's span; on injection it is this hop's span
+type PropagationContext struct {
+	CorrelationID string
+	Trace         TraceContext
+}
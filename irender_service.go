@@ -0,0 +1,14 @@
+package omnis
+
+import (
+	"github.com/ternarybob/arbor"
+)
+
+type IRenderService interface {
+	WithConfig(config *ServiceConfig) IRenderService
+	WithLogger(logger arbor.ILogger) IRenderService
+	AsResult(code int, result interface{})
+	AsError(code int, err error)
+	AsResultWithError(code int, result interface{}, err error)
+	AsModel(code int, model interface{})
+}
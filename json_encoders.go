@@ -0,0 +1,57 @@
+// -----------------------------------------------------------------------
+// JSON Encoders
+// Adapters for the JSON libraries available to the renderer
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"bytes"
+	"encoding/json"
+
+	gojson "github.com/goccy/go-json"
+)
+
+// StdJSON returns the encoding/json adapter, used when JSONRendererConfig.JSONEncoder is not set
+func StdJSON() IJSONEncoder { return stdJSON{} }
+
+type stdJSON struct{}
+
+func (stdJSON) Marshal(v interface{}, indent bool) ([]byte, error) {
+	var output bytes.Buffer
+
+	encoder := json.NewEncoder(&output)
+	encoder.SetEscapeHTML(false)
+	if indent {
+		encoder.SetIndent("", "  ")
+	}
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	// Encode terminates the value with a newline, Marshal does not
+	return bytes.TrimSuffix(output.Bytes(), []byte("\n")), nil
+}
+
+func (stdJSON) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (stdJSON) Valid(data []byte) bool { return json.Valid(data) }
+
+// GoccyJSON returns the github.com/goccy/go-json adapter
+// go-json re-compacts the output of every json.Marshaler, including the json.RawMessage the
+// interceptor splices the handler's body in as, so enveloping large bodies is slower than with StdJSON
+func GoccyJSON() IJSONEncoder { return goccyJSON{} }
+
+type goccyJSON struct{}
+
+func (goccyJSON) Marshal(v interface{}, indent bool) ([]byte, error) {
+	if indent {
+		return gojson.MarshalIndentWithOption(v, "", "  ", gojson.DisableHTMLEscape())
+	}
+	return gojson.MarshalWithOption(v, gojson.DisableHTMLEscape())
+}
+
+func (goccyJSON) Unmarshal(data []byte, v interface{}) error { return gojson.Unmarshal(data, v) }
+
+func (goccyJSON) Valid(data []byte) bool { return gojson.Valid(data) }
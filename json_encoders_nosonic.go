@@ -0,0 +1,12 @@
+//go:build !sonic
+
+package omnis
+
+// SonicJSON returns the github.com/bytedance/sonic adapter, but built without -tags sonic it returns
+// the encoding/json adapter (StdJSON) instead; check SONIC_ENABLED to tell which one is in use
+// sonic only supports specific Go versions and platforms, so it is opt-in at build time
+func SonicJSON() IJSONEncoder { return stdJSON{} }
+
+// SONIC_ENABLED reports whether SonicJSON uses sonic rather than encoding/json, i.e. whether
+// the package was built with -tags sonic
+const SONIC_ENABLED = false
@@ -0,0 +1,37 @@
+//go:build sonic
+
+package omnis
+
+import (
+	"github.com/bytedance/sonic"
+)
+
+// sonicAPI matches encoding/json behaviour apart from HTML escaping
+var sonicAPI = sonic.Config{
+	SortMapKeys:      true,
+	CompactMarshaler: true,
+	CopyString:       true,
+	ValidateString:   true,
+}.Froze()
+
+// SonicJSON returns the github.com/bytedance/sonic adapter
+// Build with -tags sonic to enable it, since sonic only supports specific Go versions and platforms;
+// without the tag it returns the encoding/json adapter (see SONIC_ENABLED)
+func SonicJSON() IJSONEncoder { return sonicJSON{} }
+
+// SONIC_ENABLED reports whether SonicJSON uses sonic rather than encoding/json, i.e. whether
+// the package was built with -tags sonic
+const SONIC_ENABLED = true
+
+type sonicJSON struct{}
+
+func (sonicJSON) Marshal(v interface{}, indent bool) ([]byte, error) {
+	if indent {
+		return sonicAPI.MarshalIndent(v, "", "  ")
+	}
+	return sonicAPI.Marshal(v)
+}
+
+func (sonicJSON) Unmarshal(data []byte, v interface{}) error { return sonicAPI.Unmarshal(data, v) }
+
+func (sonicJSON) Valid(data []byte) bool { return sonicAPI.Valid(data) }
@@ -0,0 +1,154 @@
+// -----------------------------------------------------------------------
+// JSON Encoder Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonEncoders lists the adapters under test
+// Sonic is only listed when built with -tags sonic: without the tag, SonicJSON is encoding/json
+var jsonEncoders = map[string]IJSONEncoder{
+	"Std":   StdJSON(),
+	"Goccy": GoccyJSON(),
+}
+
+func init() {
+	if SONIC_ENABLED {
+		jsonEncoders["Sonic"] = SonicJSON()
+	}
+}
+
+// jsonEncoderNames orders the adapters; rows for adapters not in jsonEncoders are skipped
+var jsonEncoderNames = []string{"Std", "Sonic", "Goccy"}
+
+// SONIC_SKIP_REASON explains skipped Sonic tests and benchmarks
+const SONIC_SKIP_REASON = "SonicJSON is encoding/json without -tags sonic"
+
+func TestJSONEncoders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type ordered struct {
+		Zebra string `json:"zebra"`
+		Apple int64  `json:"apple"`
+		HTML  string `json:"html"`
+	}
+
+	serve := func(encoder IJSONEncoder, scope string, handler gin.HandlerFunc) string {
+		r := newTestRouter(nil, &JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "test-service", Version: "1.0.0", Scope: scope},
+			JSONEncoder:   encoder,
+		}, "/test", handler)
+		return serveTestRequest(r, "/test", withHeader("X-Correlation-ID", "encoder-test")).Body.String()
+	}
+
+	handlers := map[string]gin.HandlerFunc{
+		"Ordered Struct": func(c *gin.Context) {
+			c.JSON(http.StatusOK, ordered{Zebra: "z", Apple: math.MaxInt64, HTML: "<b>&</b>"})
+		},
+		"Pure JSON": func(c *gin.Context) {
+			c.PureJSON(http.StatusOK, gin.H{"html": "<b>&</b>"})
+		},
+		"Error": func(c *gin.Context) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		},
+		"Rendered": func(c *gin.Context) {
+			RenderService(c).AsResult(http.StatusOK, ordered{Zebra: "z", Apple: 1})
+		},
+	}
+
+	for name, handler := range handlers {
+		for _, scope := range []string{"PRD", "DEV"} {
+			expected := serve(StdJSON(), scope, handler)
+			for _, encoderName := range jsonEncoderNames {
+				encoder, ok := jsonEncoders[encoderName]
+				t.Run(name+"/"+scope+"/"+encoderName, func(t *testing.T) {
+					if !ok {
+						t.Skip(SONIC_SKIP_REASON)
+					}
+					assert.Equal(t, expected, serve(encoder, scope, handler))
+				})
+			}
+		}
+	}
+
+	t.Run("Lossless Splice", func(t *testing.T) {
+		for encoderName, encoder := range jsonEncoders {
+			body := serve(encoder, "PRD", handlers["Ordered Struct"])
+
+			var response struct {
+				Result json.RawMessage `json:"result"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(body), &response), encoderName)
+			assert.Equal(t, `{"zebra":"z","apple":9223372036854775807,"html":"\u003cb\u003e\u0026\u003c/b\u003e"}`,
+				string(response.Result), encoderName)
+		}
+	})
+}
+
+// BenchmarkJSONEncoders compares envelope throughput of the JSON libraries on a small
+// object, a 50 item list and a 500 item list
+func BenchmarkJSONEncoders(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	list := benchmarkPayload(b)
+	var users []json.RawMessage
+	var decoded struct {
+		Users []json.RawMessage `json:"users"`
+	}
+	require.NoError(b, json.Unmarshal(list, &decoded))
+	for i := 0; i < 10; i++ {
+		users = append(users, decoded.Users...)
+	}
+	large, err := json.Marshal(gin.H{"users": users, "count": len(users)})
+	require.NoError(b, err)
+
+	payloads := []struct {
+		name string
+		data []byte
+	}{
+		{"Small", []byte(`{"id":9007199254740993,"name":"widget","active":true}`)},
+		{"List" + strconv.Itoa(len(decoded.Users)), list},
+		{"List" + strconv.Itoa(len(users)), large},
+	}
+
+	for _, payload := range payloads {
+		for _, encoderName := range jsonEncoderNames {
+			encoder, ok := jsonEncoders[encoderName]
+			if !ok {
+				b.Run(payload.name+"/"+encoderName, func(b *testing.B) { b.Skip(SONIC_SKIP_REASON) })
+				continue
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/users", nil)
+			c.Set(CORRELATION_ID_KEY, "benchmark")
+			c.Header("Content-Type", "application/json; charset=utf-8")
+
+			w := newJSONResponseInterceptor(c, &JSONRendererConfig{
+				ServiceConfig: &ServiceConfig{Name: "bench-service", Version: "1.0.0", Scope: "PRD"},
+				JSONEncoder:   encoder,
+			})
+
+			data := payload.data
+			b.Run(payload.name+"/"+encoderName, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					w.envelope(data)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,522 @@
+// -----------------------------------------------------------------------
+// Log Buffer
+// Per-request ring buffer sink for arbor, slog and phuslu loggers
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+	"github.com/ternarybob/arbor/writers"
+)
+
+// DEFAULT_LOG_BUFFER_SIZE is the capacity of a log buffer created with a size of zero or less
+const DEFAULT_LOG_BUFFER_SIZE = 256
+
+// LogBuffer is a ring buffer of one request's log entries, attached to the gin context under LOG_BUFFER
+// It is a slog.Handler, a phuslu log.Writer and an arbor writer, so the envelope's log section
+// works whatever the application's global logging setup; once full, the oldest entries are dropped
+// Usage: slog.New(omnis.GetLogBuffer(c)) or log.Logger{Writer: omnis.GetLogBuffer(c)}
+type LogBuffer struct {
+	mu      sync.Mutex
+	entries []bufferedEntry
+	next    int // Position of the oldest entry once the buffer is full
+	index   uint64
+	dropped int
+}
+
+// bufferedEntry is a LogEntry with its level, for filtering by the capture level
+type bufferedEntry struct {
+	LogEntry
+	level log.Level
+}
+
+// NewLogBuffer creates a log buffer holding up to size entries
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = DEFAULT_LOG_BUFFER_SIZE
+	}
+	return &LogBuffer{entries: make([]bufferedEntry, 0, size)}
+}
+
+// GetLogBuffer returns the request's log buffer, or nil when none is attached
+// Usage: logger := slog.New(omnis.GetLogBuffer(c))
+func GetLogBuffer(c *gin.Context) *LogBuffer {
+	if c == nil {
+		return nil
+	}
+	if buffer, ok := c.Value(LOG_BUFFER).(*LogBuffer); ok {
+		return buffer
+	}
+	return nil
+}
+
+// add stores an entry, numbering it and overwriting the oldest entry when full
+func (b *LogBuffer) add(level log.Level, entry LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.index++
+	entry.Index = formatLogIndex(b.index)
+	entry.Level = arbor.LevelToString(level)
+	buffered := bufferedEntry{LogEntry: entry, level: level}
+
+	if len(b.entries) < cap(b.entries) {
+		b.entries = append(b.entries, buffered)
+		return
+	}
+	b.entries[b.next] = buffered
+	b.next = (b.next + 1) % len(b.entries)
+	b.dropped++
+}
+
+// snapshot returns the buffered entries, oldest first, and the number dropped
+func (b *LogBuffer) snapshot() ([]bufferedEntry, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := make([]bufferedEntry, 0, len(b.entries))
+	entries = append(entries, b.entries[b.next:]...)
+	entries = append(entries, b.entries[:b.next]...)
+	return entries, b.dropped
+}
+
+// Entries returns the buffered entries, oldest first
+func (b *LogBuffer) Entries() []LogEntry {
+	buffered, _ := b.snapshot()
+	entries := make([]LogEntry, len(buffered))
+	for i := range buffered {
+		entries[i] = buffered[i].LogEntry
+	}
+	return entries
+}
+
+// Write stores an arbor log event, so the buffer can be registered as an arbor writer
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	var event models.LogEvent
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	b.addEvent(event)
+	return len(p), nil
+}
+
+// WithLevel is a no-op: every entry is stored and the capture level is applied when the envelope is rendered
+func (b *LogBuffer) WithLevel(level log.Level) writers.IWriter {
+	return b
+}
+
+// addEvent stores an arbor log event, keeping its error as the "error" field
+func (b *LogBuffer) addEvent(event models.LogEvent) {
+	b.add(event.Level, eventLogEntry(&event))
+}
+
+// WriteEntry stores a phuslu log entry, so the buffer can be used as a phuslu log.Writer
+func (b *LogBuffer) WriteEntry(e *log.Entry) (int, error) {
+	data := e.Value()
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return 0, err
+	}
+
+	entry := LogEntry{Timestamp: time.Now()}
+	if value, ok := fields["time"].(string); ok {
+		if timestamp, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			entry.Timestamp = timestamp
+		}
+	}
+	entry.Message, _ = fields["message"].(string)
+	entry.Caller, _ = fields["caller"].(string)
+
+	for _, key := range []string{"time", "level", "message", "caller", "callerfunc", "goid"} {
+		delete(fields, key)
+	}
+	if len(fields) > 0 {
+		entry.Fields = fields
+	}
+
+	b.add(e.Level, entry)
+	return len(data), nil
+}
+
+// Enabled reports true for every level: the capture level is applied when the envelope is rendered
+func (b *LogBuffer) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// Handle stores a slog record, so the buffer can be used as a slog.Handler
+func (b *LogBuffer) Handle(ctx context.Context, record slog.Record) error {
+	return (&logBufferHandler{buffer: b}).Handle(ctx, record)
+}
+
+// WithAttrs returns a handler writing to the buffer with the attributes added to every record
+func (b *LogBuffer) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return (&logBufferHandler{buffer: b}).WithAttrs(attrs)
+}
+
+// WithGroup returns a handler writing to the buffer with later attributes nested under the group
+func (b *LogBuffer) WithGroup(name string) slog.Handler {
+	return (&logBufferHandler{buffer: b}).WithGroup(name)
+}
+
+// logBufferHandler is a slog.Handler derived from a LogBuffer with attributes or groups
+type logBufferHandler struct {
+	buffer *LogBuffer
+	attrs  []groupedAttr
+	groups []string
+}
+
+// groupedAttr is an attribute added with WithAttrs and the groups open at the time
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+func (h *logBufferHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *logBufferHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := map[string]interface{}{}
+	for _, attr := range h.attrs {
+		setAttr(fields, attr.groups, attr.attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		setAttr(fields, h.groups, attr)
+		return true
+	})
+
+	entry := LogEntry{
+		Timestamp: record.Time,
+		Message:   record.Message,
+	}
+	if len(fields) > 0 {
+		entry.Fields = fields
+	}
+	if record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		entry.Caller = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+
+	h.buffer.add(slogLevel(record.Level), entry)
+	return nil
+}
+
+func (h *logBufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := &logBufferHandler{buffer: h.buffer, groups: h.groups}
+	derived.attrs = make([]groupedAttr, 0, len(h.attrs)+len(attrs))
+	derived.attrs = append(derived.attrs, h.attrs...)
+	for _, attr := range attrs {
+		derived.attrs = append(derived.attrs, groupedAttr{groups: h.groups, attr: attr})
+	}
+	return derived
+}
+
+func (h *logBufferHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &logBufferHandler{buffer: h.buffer, attrs: h.attrs, groups: appendPath(h.groups, name)}
+}
+
+// setAttr adds a slog attribute to the fields, nested under its groups
+// Empty attributes are ignored and groups without a key are inlined, as slog handlers should
+func setAttr(fields map[string]interface{}, groups []string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	for _, group := range groups {
+		nested, ok := fields[group].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			fields[group] = nested
+		}
+		fields = nested
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		var nested []string
+		if attr.Key != "" {
+			nested = []string{attr.Key}
+		}
+		for _, member := range attr.Value.Group() {
+			setAttr(fields, nested, member)
+		}
+	case slog.KindDuration:
+		fields[attr.Key] = attr.Value.Duration().String()
+	default:
+		if err, ok := attr.Value.Any().(error); ok {
+			fields[attr.Key] = err.Error()
+		} else {
+			fields[attr.Key] = attr.Value.Any()
+		}
+	}
+}
+
+// slogLevel maps a slog level to the nearest phuslu level, with levels below debug as trace
+func slogLevel(level slog.Level) log.Level {
+	switch {
+	case level < slog.LevelDebug:
+		return log.TraceLevel
+	case level < slog.LevelInfo:
+		return log.DebugLevel
+	case level < slog.LevelWarn:
+		return log.InfoLevel
+	case level < slog.LevelError:
+		return log.WarnLevel
+	default:
+		return log.ErrorLevel
+	}
+}
+
+// attachLogBuffer gives the request a log buffer, when configured, and binds it to the request logger
+func attachLogBuffer(c *gin.Context, config *JSONRendererConfig) {
+	if config == nil || config.LogBufferSize <= 0 {
+		return
+	}
+
+	c.Set(LOG_BUFFER, NewLogBuffer(config.LogBufferSize))
+
+	// A logger set later with WithLogger is bound there
+	if logger := GetRequestLogger(c); logger != nil {
+		WithLogger(c, logger)
+	}
+}
+
+// bind returns the logger writing each event to the buffer as well as to its own writers
+// Binding the buffer to the request logger, rather than routing events by correlation ID,
+// keeps another request sending the same correlation ID out of this request's buffer
+func (b *LogBuffer) bind(logger arbor.ILogger) arbor.ILogger {
+	if bound, ok := logger.(*logBufferLogger); ok {
+		if bound.buffer == b {
+			return bound
+		}
+		logger = bound.ILogger
+	}
+	return &logBufferLogger{ILogger: logger, buffer: b}
+}
+
+// logBufferLogger is a request logger that also writes its events to the request's log buffer
+// The With methods are overridden so chained calls keep the binding
+type logBufferLogger struct {
+	arbor.ILogger
+	buffer *LogBuffer
+	prefix string
+}
+
+func (l *logBufferLogger) WithConsoleWriter(config models.WriterConfiguration) arbor.ILogger {
+	l.ILogger.WithConsoleWriter(config)
+	return l
+}
+
+func (l *logBufferLogger) WithFileWriter(config models.WriterConfiguration) arbor.ILogger {
+	l.ILogger.WithFileWriter(config)
+	return l
+}
+
+func (l *logBufferLogger) WithMemoryWriter(config models.WriterConfiguration) arbor.ILogger {
+	l.ILogger.WithMemoryWriter(config)
+	return l
+}
+
+func (l *logBufferLogger) WithPrefix(value string) arbor.ILogger {
+	l.ILogger.WithPrefix(value)
+	if value != "" {
+		l.prefix = value
+	}
+	return l
+}
+
+func (l *logBufferLogger) WithCorrelationId(value string) arbor.ILogger {
+	l.ILogger.WithCorrelationId(value)
+	return l
+}
+
+func (l *logBufferLogger) ClearCorrelationId() arbor.ILogger {
+	l.ILogger.ClearCorrelationId()
+	return l
+}
+
+func (l *logBufferLogger) ClearContext() arbor.ILogger {
+	l.ILogger.ClearContext()
+	l.prefix = ""
+	return l
+}
+
+func (l *logBufferLogger) WithLevel(level arbor.LogLevel) arbor.ILogger {
+	l.ILogger.WithLevel(level)
+	return l
+}
+
+func (l *logBufferLogger) WithLevelFromString(level string) arbor.ILogger {
+	l.ILogger.WithLevelFromString(level)
+	return l
+}
+
+func (l *logBufferLogger) WithContext(key string, value string) arbor.ILogger {
+	l.ILogger.WithContext(key, value)
+	return l
+}
+
+// Copy returns a copy with a clean context, still bound to the buffer
+func (l *logBufferLogger) Copy() arbor.ILogger {
+	return &logBufferLogger{ILogger: l.ILogger.Copy(), buffer: l.buffer}
+}
+
+func (l *logBufferLogger) Trace() arbor.ILogEvent { return l.event(log.TraceLevel, l.ILogger.Trace()) }
+func (l *logBufferLogger) Debug() arbor.ILogEvent { return l.event(log.DebugLevel, l.ILogger.Debug()) }
+func (l *logBufferLogger) Info() arbor.ILogEvent  { return l.event(log.InfoLevel, l.ILogger.Info()) }
+func (l *logBufferLogger) Warn() arbor.ILogEvent  { return l.event(log.WarnLevel, l.ILogger.Warn()) }
+func (l *logBufferLogger) Error() arbor.ILogEvent { return l.event(log.ErrorLevel, l.ILogger.Error()) }
+func (l *logBufferLogger) Fatal() arbor.ILogEvent { return l.event(log.FatalLevel, l.ILogger.Fatal()) }
+func (l *logBufferLogger) Panic() arbor.ILogEvent { return l.event(log.PanicLevel, l.ILogger.Panic()) }
+
+// event wraps an arbor event so its fields are recorded for the buffer
+func (l *logBufferLogger) event(level log.Level, event arbor.ILogEvent) arbor.ILogEvent {
+	return logBufferEventWrapper{&logBufferEvent{ILogEvent: event, logger: l, level: level, fields: map[string]interface{}{}}}
+}
+
+// logBufferEvent is an arbor event that is written to the log buffer before its logger's writers
+// Every level is buffered, whatever the writers' levels; the capture level is applied when the envelope is rendered
+type logBufferEvent struct {
+	arbor.ILogEvent
+	logger *logBufferLogger
+	level  log.Level
+	fields map[string]interface{}
+}
+
+// logBufferEventWrapper is the arbor.ILogEvent of a logBufferEvent
+// arbor v1.4.37 has no caller-skip option and reports this wrapper's Msg as the event's function, so the
+// wrapper looks up the function that logged the event itself and passes it to arbor's writers as "caller"
+type logBufferEventWrapper struct {
+	*logBufferEvent
+}
+
+func (e logBufferEventWrapper) Strs(key string, values []string) arbor.ILogEvent {
+	e.fields[key] = values
+	e.ILogEvent.Strs(key, values)
+	return e
+}
+
+func (e logBufferEventWrapper) Str(key, value string) arbor.ILogEvent {
+	e.fields[key] = value
+	e.ILogEvent.Str(key, value)
+	return e
+}
+
+func (e logBufferEventWrapper) Err(err error) arbor.ILogEvent {
+	if err != nil {
+		e.fields["error"] = err.Error()
+	}
+	e.ILogEvent.Err(err)
+	return e
+}
+
+func (e logBufferEventWrapper) Int(key string, value int) arbor.ILogEvent {
+	e.fields[key] = value
+	e.ILogEvent.Int(key, value)
+	return e
+}
+
+func (e logBufferEventWrapper) Int32(key string, value int32) arbor.ILogEvent {
+	e.fields[key] = value
+	e.ILogEvent.Int32(key, value)
+	return e
+}
+
+func (e logBufferEventWrapper) Int64(key string, value int64) arbor.ILogEvent {
+	e.fields[key] = value
+	e.ILogEvent.Int64(key, value)
+	return e
+}
+
+func (e logBufferEventWrapper) Float32(key string, value float32) arbor.ILogEvent {
+	e.fields[key] = value
+	e.ILogEvent.Float32(key, value)
+	return e
+}
+
+func (e logBufferEventWrapper) Float64(key string, value float64) arbor.ILogEvent {
+	e.fields[key] = value
+	e.ILogEvent.Float64(key, value)
+	return e
+}
+
+func (e logBufferEventWrapper) Dur(key string, value time.Duration) arbor.ILogEvent {
+	e.fields[key] = value.String()
+	e.ILogEvent.Dur(key, value)
+	return e
+}
+
+func (e logBufferEventWrapper) Msg(message string) {
+	e.write(message, logBufferCaller())
+}
+
+func (e logBufferEventWrapper) Msgf(format string, args ...interface{}) {
+	e.write(fmt.Sprintf(format, args...), logBufferCaller())
+}
+
+// logBufferCallerSkip is the number of frames between logBufferCaller and the function that
+// logged the event: logBufferCaller itself and the wrapper's Msg or Msgf
+const logBufferCallerSkip = 2
+
+// logBufferCaller returns the name of the function that called the wrapper's Msg or Msgf
+func logBufferCaller() string {
+	if pc, _, _, ok := runtime.Caller(logBufferCallerSkip); ok {
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			return fn.Name()
+		}
+	}
+	return ""
+}
+
+// write stores the event in the buffer, then writes it to its logger's writers with the caller
+func (e *logBufferEvent) write(message, caller string) {
+	entry := LogEntry{
+		Timestamp: time.Now(),
+		Prefix:    e.logger.prefix,
+		Message:   message,
+		Caller:    caller,
+	}
+	if len(e.fields) > 0 {
+		entry.Fields = e.fields
+	}
+	e.logger.buffer.add(e.level, entry)
+
+	if caller != "" {
+		e.ILogEvent.Str("caller", caller)
+	}
+	e.ILogEvent.Msg(message)
+}
+
+// requestLogs returns ApiResponse.Log from the request's log buffer when one is attached,
+// otherwise from the logger's memory logs
+func requestLogs(c *gin.Context, logger arbor.ILogger, correlationID string, level arbor.LogLevel, config *JSONRendererConfig) map[string]interface{} {
+	if buffer := GetLogBuffer(c); buffer != nil {
+		return bufferLogs(buffer, level, config)
+	}
+	return memoryLogs(logger, correlationID, level, config)
+}
+
+// bufferLogs formats the log buffer's entries at or above the level for ApiResponse.Log,
+// in the configured format and with the configured caps
+func bufferLogs(buffer *LogBuffer, level arbor.LogLevel, config *JSONRendererConfig) map[string]interface{} {
+	buffered, dropped := buffer.snapshot()
+	return capturedLogs(buffered, dropped, level, config, "log buffer attached but no logs captured for request")
+}
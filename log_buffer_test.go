@@ -0,0 +1,212 @@
+// -----------------------------------------------------------------------
+// Log Buffer Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+	"github.com/ternarybob/arbor/writers"
+)
+
+func TestLogBuffer(t *testing.T) {
+	t.Run("Ring Buffer", func(t *testing.T) {
+		buffer := NewLogBuffer(2)
+		for _, message := range []string{"one", "two", "three"} {
+			buffer.add(log.InfoLevel, LogEntry{Message: message})
+		}
+
+		entries := buffer.Entries()
+		require.Len(t, entries, 2)
+		assert.Equal(t, "two", entries[0].Message)
+		assert.Equal(t, "003", entries[1].Index)
+		assert.Equal(t, "info", entries[1].Level)
+
+		_, dropped := buffer.snapshot()
+		assert.Equal(t, 1, dropped)
+	})
+
+	t.Run("slog Handler", func(t *testing.T) {
+		buffer := NewLogBuffer(0)
+		logger := slog.New(buffer).With("user", "jane").WithGroup("request")
+		logger.Warn("slow request", "ms", 1200, slog.Group("route", "method", "GET"), "err", errors.New("timeout"))
+		logger.Debug("details", "elapsed", 2*time.Second)
+
+		entries := buffer.Entries()
+		require.Len(t, entries, 2)
+		assert.Equal(t, "warn", entries[0].Level)
+		assert.Equal(t, "slow request", entries[0].Message)
+		assert.Equal(t, map[string]interface{}{
+			"user": "jane",
+			"request": map[string]interface{}{
+				"ms":    int64(1200),
+				"route": map[string]interface{}{"method": "GET"},
+				"err":   "timeout",
+			},
+		}, entries[0].Fields)
+		assert.Contains(t, entries[0].Caller, "log_buffer_test.go:")
+		assert.False(t, entries[0].Timestamp.IsZero())
+
+		assert.Equal(t, "debug", entries[1].Level)
+		assert.Equal(t, "2s", entries[1].Fields["request"].(map[string]interface{})["elapsed"])
+	})
+
+	t.Run("phuslu Writer", func(t *testing.T) {
+		buffer := NewLogBuffer(0)
+		logger := log.Logger{Level: log.TraceLevel, Caller: 1, Writer: buffer}
+		logger.Error().Str("order", "A-1").Int("items", 3).Msg("payment declined")
+
+		entries := buffer.Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, "error", entries[0].Level)
+		assert.Equal(t, "payment declined", entries[0].Message)
+		assert.Equal(t, map[string]interface{}{"order": "A-1", "items": float64(3)}, entries[0].Fields)
+		assert.Contains(t, entries[0].Caller, "log_buffer_test.go:")
+		assert.WithinDuration(t, time.Now(), entries[0].Timestamp, time.Minute)
+	})
+
+	t.Run("arbor Writer", func(t *testing.T) {
+		buffer := NewLogBuffer(0)
+		event, err := json.Marshal(models.LogEvent{
+			Level:     log.WarnLevel,
+			Timestamp: time.Now(),
+			Prefix:    "Orders",
+			Message:   "retrying",
+			Error:     "connection reset",
+			Function:  "main.placeOrder",
+			Fields:    map[string]interface{}{"attempt": 2},
+		})
+		require.NoError(t, err)
+		_, err = buffer.Write(event)
+		require.NoError(t, err)
+
+		entries := buffer.Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, "Orders", entries[0].Prefix)
+		assert.Equal(t, "main.placeOrder", entries[0].Caller)
+		assert.Equal(t, map[string]interface{}{"attempt": float64(2), "error": "connection reset"}, entries[0].Fields)
+
+		logs := bufferLogs(buffer, arbor.InfoLevel, nil)
+		assert.Regexp(t, `^WRN\|.+\|Orders\|retrying\|connection reset$`, logs["entries"].(map[string]string)["001"])
+	})
+}
+
+// functionWriter records the last arbor event it receives
+type functionWriter struct {
+	event *models.LogEvent
+}
+
+func (w functionWriter) WithLevel(log.Level) writers.IWriter { return w }
+
+func (w functionWriter) Write(p []byte) (int, error) {
+	var event models.LogEvent
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	*w.event = event
+	return len(p), nil
+}
+
+func TestLogBufferLogger(t *testing.T) {
+	var event models.LogEvent
+	arbor.RegisterWriter("function", functionWriter{event: &event})
+	t.Cleanup(func() { arbor.UnregisterWriter("function") })
+
+	buffer := NewLogBuffer(0)
+	logger := buffer.bind(arbor.NewLogger())
+	assert.Same(t, logger, buffer.bind(logger))
+
+	logger.WithPrefix("Orders").Debug().Int("items", 2).Err(errors.New("declined")).Msgf("order %s", "A-1")
+
+	entries := buffer.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "debug", entries[0].Level)
+	assert.Equal(t, "Orders", entries[0].Prefix)
+	assert.Equal(t, "order A-1", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"items": 2, "error": "declined"}, entries[0].Fields)
+	assert.Equal(t, "github.com/ternarybob/omnis.TestLogBufferLogger", entries[0].Caller)
+
+	// The logger's own writers get the caller too, not just the buffer's wrapper
+	assert.Equal(t, "github.com/ternarybob/omnis.TestLogBufferLogger", event.Fields["caller"])
+	assert.Equal(t, "github.com/ternarybob/omnis.TestLogBufferLogger", eventLogEntry(&event).Caller)
+	assert.NotContains(t, eventLogEntry(&event).Fields, "caller")
+
+	logger.Info().Msg("unformatted")
+	assert.Equal(t, "github.com/ternarybob/omnis.TestLogBufferLogger", buffer.Entries()[1].Caller)
+	assert.Equal(t, "github.com/ternarybob/omnis.TestLogBufferLogger", event.Fields["caller"])
+
+	// Other buffers take over the binding
+	other := NewLogBuffer(0)
+	other.bind(logger).Info().Msg("rebound")
+	assert.Len(t, buffer.Entries(), 2)
+	assert.Len(t, other.Entries(), 1)
+}
+
+func TestLogBufferMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(SetCorrelationID())
+	r.Use(JSONMiddlewareWithConfig(&JSONRendererConfig{
+		ServiceConfig:   &ServiceConfig{Name: "test-service", Scope: "DEV"},
+		DefaultLogger:   arbor.NewLogger(),
+		ProvisionLogger: true,
+		LogFormat:       LOG_FORMAT_STRUCTURED,
+		LogBufferSize:   16,
+	}))
+	r.GET("/checkout", func(c *gin.Context) {
+		buffer := GetLogBuffer(c)
+		require.NotNil(t, buffer)
+
+		slog.New(buffer).Info("via slog", "cart", 3)
+		slog.New(buffer).Debug("below the capture level")
+		(&log.Logger{Level: log.InfoLevel, Writer: buffer}).Info().Msg("via phuslu")
+		GetRequestLogger(c).WithPrefix("Checkout").Info().Str("step", "pay").Msg("via arbor")
+
+		// Neither another logger nor another request with the same correlation ID reaches this buffer
+		arbor.NewLogger().WithCorrelationId(GetCorrelationID(c)).Info().Msg("not this request's logger")
+		if c.Query("nested") == "" {
+			req, _ := http.NewRequest("GET", "/checkout?nested=1", nil)
+			req.Header.Set("X-Correlation-ID", GetCorrelationID(c))
+			r.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	req, _ := http.NewRequest("GET", "/checkout", nil)
+	req.Header.Set("X-Correlation-ID", "log-buffer-checkout")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Log struct {
+			Count   int        `json:"count"`
+			Entries []LogEntry `json:"entries"`
+		} `json:"log"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	require.Equal(t, 3, response.Log.Count)
+	assert.Equal(t, "via slog", response.Log.Entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"cart": float64(3)}, response.Log.Entries[0].Fields)
+	assert.Equal(t, "via phuslu", response.Log.Entries[1].Message)
+	assert.Equal(t, "via arbor", response.Log.Entries[2].Message)
+	assert.Equal(t, "Checkout", response.Log.Entries[2].Prefix)
+	assert.Equal(t, map[string]interface{}{"step": "pay"}, response.Log.Entries[2].Fields)
+	assert.Contains(t, response.Log.Entries[2].Caller, "TestLogBufferMiddleware")
+}
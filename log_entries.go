@@ -0,0 +1,277 @@
+// -----------------------------------------------------------------------
+// Log Entries
+// Formats captured memory logs for ApiResponse.Log
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+)
+
+// LOG_TRUNCATION_SUFFIX marks messages cut to JSONRendererConfig.MaxLogMessageLength
+const LOG_TRUNCATION_SUFFIX = "…"
+
+// logLevelNames maps the level abbreviations of arbor's memory log lines to level names
+var logLevelNames = map[string]string{
+	"TRC": "trace",
+	"DBG": "debug",
+	"INF": "info",
+	"WRN": "warn",
+	"ERR": "error",
+	"FTL": "fatal",
+	"PNC": "panic",
+}
+
+// captureLogLevel returns the minimum level of the logs captured for the request: the configured
+// ApiLogLevel (default: info), lowered by an X-Omnis-Log-Level header, e.g. "debug" or "trace"
+// The header is honoured in DEV scope, otherwise only for requests the debug policy authorizes,
+// and can only make the capture more verbose. Without a service config or scope, the scope is not DEV
+func captureLogLevel(c *gin.Context, config *JSONRendererConfig) arbor.LogLevel {
+	level := apiLogLevel(config)
+
+	if c == nil || c.Request == nil {
+		return level
+	}
+	header := strings.TrimSpace(c.GetHeader(LOG_LEVEL_HEADER))
+	if header == "" {
+		return level
+	}
+
+	requested, err := arbor.ParseLevelString(header)
+	if err != nil || arbor.LogLevel(requested) >= level {
+		return level
+	}
+
+	if config == nil || (!hasDevScope(config.ServiceConfig) && !config.DebugPolicy.Authorized(c)) {
+		return level
+	}
+	return arbor.LogLevel(requested)
+}
+
+// apiLogLevel returns the configured ApiLogLevel, or info
+func apiLogLevel(config *JSONRendererConfig) arbor.LogLevel {
+	if config != nil && config.ApiLogLevel != 0 {
+		return config.ApiLogLevel
+	}
+	return arbor.InfoLevel
+}
+
+// logEntries formats memory log lines in the configured format, applying the entry and message caps
+// The most recent entries are kept; it returns the entries and the number dropped by the cap
+func logEntries(logs map[string]string, config *JSONRendererConfig) (interface{}, int) {
+	maxEntries, maxLength, structured := logFormat(config)
+
+	keys := sortedLogKeys(logs)
+	dropped := 0
+	if maxEntries > 0 && len(keys) > maxEntries {
+		dropped = len(keys) - maxEntries
+		keys = keys[dropped:]
+	}
+
+	if structured {
+		entries := make([]LogEntry, 0, len(keys))
+		for _, key := range keys {
+			entry := parseLogEntry(key, logs[key])
+			entry.Message = truncateMessage(entry.Message, maxLength)
+			entries = append(entries, entry)
+		}
+		return entries, dropped
+	}
+
+	entries := make(map[string]string, len(keys))
+	for _, key := range keys {
+		line := logs[key]
+		_, _, _, message := splitLogLine(line)
+		entries[key] = line[:len(line)-len(message)] + truncateMessage(message, maxLength)
+	}
+	return entries, dropped
+}
+
+// capturedLogs formats entries at or above the level for ApiResponse.Log, in the configured format
+// and with the configured caps; dropped counts entries already lost, empty is the status without entries
+func capturedLogs(buffered []bufferedEntry, dropped int, level arbor.LogLevel, config *JSONRendererConfig, empty string) map[string]interface{} {
+	minLevel := level.ToLogLevel()
+	captured := buffered[:0]
+	for _, entry := range buffered {
+		if entry.level >= minLevel {
+			captured = append(captured, entry)
+		}
+	}
+
+	if len(captured) == 0 {
+		return map[string]interface{}{
+			"status": empty,
+		}
+	}
+
+	maxEntries, maxLength, structured := logFormat(config)
+	if maxEntries > 0 && len(captured) > maxEntries {
+		dropped += len(captured) - maxEntries
+		captured = captured[len(captured)-maxEntries:]
+	}
+
+	var entries interface{}
+	if structured {
+		structuredEntries := make([]LogEntry, len(captured))
+		for i, entry := range captured {
+			structuredEntries[i] = entry.LogEntry
+			structuredEntries[i].Message = truncateMessage(entry.Message, maxLength)
+		}
+		entries = structuredEntries
+	} else {
+		lines := make(map[string]string, len(captured))
+		for _, entry := range captured {
+			err, _ := entry.Fields["error"].(string)
+			lines[entry.Index] = formatLogLine(entry.level, entry.Timestamp, entry.Prefix, truncateMessage(entry.Message, maxLength), err)
+		}
+		entries = lines
+	}
+
+	response := map[string]interface{}{
+		"count":   len(captured),
+		"entries": entries,
+	}
+	if dropped > 0 {
+		response["dropped"] = dropped
+	}
+	return response
+}
+
+// storeLogs formats a MemoryLogStore's entries for the correlation ID from its log events,
+// so prefixes and messages are exact and fields and the caller are kept
+func storeLogs(store *MemoryLogStore, correlationID string, level arbor.LogLevel, config *JSONRendererConfig) map[string]interface{} {
+	events := store.GetEventsWithLevel(correlationID, level.ToLogLevel())
+
+	buffered := make([]bufferedEntry, len(events))
+	for i := range events {
+		entry := eventLogEntry(&events[i])
+		entry.Index = formatLogIndex(events[i].Index)
+		entry.Level = arbor.LevelToString(events[i].Level)
+		buffered[i] = bufferedEntry{LogEntry: entry, level: events[i].Level}
+	}
+
+	return capturedLogs(buffered, 0, level, config, "request logger set but no logs captured for correlation ID")
+}
+
+// eventLogEntry converts an arbor log event into a LogEntry, keeping its error as the "error" field
+// A "caller" field, as a log buffer's request logger forwards, takes the place of the event's function
+// The index and level name are left for the caller to set
+func eventLogEntry(event *models.LogEvent) LogEntry {
+	caller, forwarded := event.Fields["caller"].(string)
+	if !forwarded || caller == "" {
+		caller = event.Function
+	}
+
+	fields := event.Fields
+	if event.Error != "" || forwarded {
+		fields = make(map[string]interface{}, len(event.Fields)+1)
+		for key, value := range event.Fields {
+			fields[key] = value
+		}
+		if forwarded {
+			delete(fields, "caller")
+		}
+		if event.Error != "" {
+			fields["error"] = event.Error
+		}
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+
+	return LogEntry{
+		Timestamp: event.Timestamp,
+		Prefix:    event.Prefix,
+		Message:   event.Message,
+		Fields:    fields,
+		Caller:    caller,
+	}
+}
+
+// logFormat returns the configured entry cap, message length cap and whether entries are structured
+func logFormat(config *JSONRendererConfig) (maxEntries int, maxLength int, structured bool) {
+	if config == nil {
+		return 0, 0, false
+	}
+	return config.MaxLogEntries, config.MaxLogMessageLength, strings.EqualFold(config.LogFormat, LOG_FORMAT_STRUCTURED)
+}
+
+// sortedLogKeys returns the entry indexes in log order
+// Indexes are zero-padded to three digits, so longer indexes sort after shorter ones
+func sortedLogKeys(logs map[string]string) []string {
+	keys := make([]string, 0, len(logs))
+	for key := range logs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// parseLogEntry converts an arbor memory log line into a LogEntry
+// arbor's memory writer does not keep fields or the caller, so those are left empty, and its lines
+// cannot always be split exactly (see splitLogLine); a MemoryLogStore is read from its events instead
+func parseLogEntry(index string, line string) LogEntry {
+	level, timestamp, prefix, message := splitLogLine(line)
+	entry := LogEntry{
+		Index:   index,
+		Level:   logLevelNames[level],
+		Prefix:  prefix,
+		Message: message,
+	}
+
+	if t, err := time.ParseInLocation(time.Stamp, timestamp, time.Local); err == nil {
+		// The line carries no year: use the current one, unless that puts the entry in the future
+		now := time.Now()
+		entry.Timestamp = t.AddDate(now.Year(), 0, 0)
+		if entry.Timestamp.After(now.Add(24 * time.Hour)) {
+			entry.Timestamp = entry.Timestamp.AddDate(-1, 0, 0)
+		}
+	}
+
+	return entry
+}
+
+// splitLogLine splits a "LVL|time|prefix|message|error" memory log line, where empty parts are omitted
+// The line does not mark which parts are present, so with four or more parts the third is taken as
+// the prefix and the rest as the message, even when the line has no prefix and the message or error
+// contains '|'. Lines without a known level are all message; with three parts there is no prefix
+func splitLogLine(line string) (level, timestamp, prefix, message string) {
+	parts := strings.SplitN(line, "|", 4)
+	if _, ok := logLevelNames[parts[0]]; !ok || len(parts) < 3 {
+		return "", "", "", line
+	}
+
+	if len(parts) == 3 {
+		return parts[0], parts[1], "", parts[2]
+	}
+	return parts[0], parts[1], parts[2], parts[3]
+}
+
+// truncateMessage cuts a message to max characters, marking the cut; max <= 0 disables the cap
+func truncateMessage(message string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(message) <= max {
+		return message
+	}
+
+	count := 0
+	for i := range message {
+		if count == max {
+			return message[:i] + LOG_TRUNCATION_SUFFIX
+		}
+		count++
+	}
+	return message
+}
@@ -0,0 +1,275 @@
+// -----------------------------------------------------------------------
+// Log Entries Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+	"github.com/ternarybob/arbor/writers"
+)
+
+func TestLogEntries(t *testing.T) {
+	logs := map[string]string{
+		"001":  "INF|Oct 16 15:11:14|API|request started",
+		"002":  "DBG|Oct 16 15:11:15|found 2 users",
+		"003":  "WRN|Oct 16 15:11:16|API|slow query: users|select took 2s",
+		"1000": "ERR|Oct 16 15:11:17|API|request failed",
+	}
+
+	t.Run("Parse Line", func(t *testing.T) {
+		entry := parseLogEntry("001", logs["001"])
+		assert.Equal(t, "001", entry.Index)
+		assert.Equal(t, "info", entry.Level)
+		assert.Equal(t, "API", entry.Prefix)
+		assert.Equal(t, "request started", entry.Message)
+		assert.Equal(t, time.October, entry.Timestamp.Month())
+		assert.Equal(t, 16, entry.Timestamp.Day())
+		assert.Equal(t, 15, entry.Timestamp.Hour())
+		assert.False(t, entry.Timestamp.After(time.Now().Add(24*time.Hour)))
+
+		entry = parseLogEntry("002", logs["002"])
+		assert.Equal(t, "debug", entry.Level)
+		assert.Empty(t, entry.Prefix)
+		assert.Equal(t, "found 2 users", entry.Message)
+
+		entry = parseLogEntry("003", logs["003"])
+		assert.Equal(t, "slow query: users|select took 2s", entry.Message)
+
+		entry = parseLogEntry("004", "unformatted line")
+		assert.Empty(t, entry.Level)
+		assert.Equal(t, "unformatted line", entry.Message)
+	})
+
+	t.Run("Legacy Format", func(t *testing.T) {
+		entries, dropped := logEntries(logs, nil)
+		assert.Equal(t, 0, dropped)
+		assert.Equal(t, logs, entries)
+	})
+
+	t.Run("Structured Format", func(t *testing.T) {
+		entries, dropped := logEntries(logs, &JSONRendererConfig{LogFormat: LOG_FORMAT_STRUCTURED})
+		assert.Equal(t, 0, dropped)
+
+		structured, ok := entries.([]LogEntry)
+		require.True(t, ok)
+		require.Len(t, structured, 4)
+		assert.Equal(t, []string{"001", "002", "003", "1000"},
+			[]string{structured[0].Index, structured[1].Index, structured[2].Index, structured[3].Index})
+		assert.Equal(t, "error", structured[3].Level)
+	})
+
+	t.Run("Caps", func(t *testing.T) {
+		config := &JSONRendererConfig{MaxLogEntries: 2, MaxLogMessageLength: 7}
+
+		entries, dropped := logEntries(logs, config)
+		assert.Equal(t, 2, dropped)
+		assert.Equal(t, map[string]string{
+			"003":  "WRN|Oct 16 15:11:16|API|slow qu…",
+			"1000": "ERR|Oct 16 15:11:17|API|request…",
+		}, entries)
+
+		config.LogFormat = LOG_FORMAT_STRUCTURED
+		entries, _ = logEntries(logs, config)
+		structured := entries.([]LogEntry)
+		require.Len(t, structured, 2)
+		assert.Equal(t, "slow qu…", structured[0].Message)
+
+		assert.Equal(t, "héllo…", truncateMessage("héllo wörld", 5))
+		assert.Equal(t, "short", truncateMessage("short", 5))
+	})
+}
+
+func TestStructuredLogMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger := arbor.Logger().WithMemoryWriter(models.WriterConfiguration{})
+	redactor, err := NewRedactor(RedactionConfig{Detectors: DefaultDetectors()})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(SetCorrelationID())
+	r.Use(JSONMiddlewareWithConfig(&JSONRendererConfig{
+		ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "DEV"},
+		LogFormat:     LOG_FORMAT_STRUCTURED,
+		MaxLogEntries: 2,
+		Redactor:      redactor,
+	}))
+	r.GET("/users", func(c *gin.Context) {
+		requestLogger := logger.WithCorrelationId(GetCorrelationID(c)).WithPrefix("Users")
+		WithLogger(c, requestLogger)
+		requestLogger.Info().Msg("listing users")
+		requestLogger.Info().Msg("found 2 users")
+		requestLogger.Warn().Msg("mail bounced for jane@example.com")
+
+		c.JSON(http.StatusOK, gin.H{"users": []string{"alice", "bob"}})
+	})
+
+	req, _ := http.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-Correlation-ID", "structured-logs")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Log struct {
+			Count   int        `json:"count"`
+			Dropped int        `json:"dropped"`
+			Entries []LogEntry `json:"entries"`
+		} `json:"log"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.Equal(t, 2, response.Log.Count)
+	assert.Equal(t, 1, response.Log.Dropped)
+	require.Len(t, response.Log.Entries, 2)
+	assert.Equal(t, "info", response.Log.Entries[0].Level)
+	assert.Equal(t, "Users", response.Log.Entries[0].Prefix)
+	assert.Equal(t, "found 2 users", response.Log.Entries[0].Message)
+	assert.Equal(t, "warn", response.Log.Entries[1].Level)
+	assert.Equal(t, "mail bounced for [REDACTED]", response.Log.Entries[1].Message)
+	assert.False(t, response.Log.Entries[1].Timestamp.IsZero())
+	assert.False(t, strings.Contains(w.Body.String(), "jane@example.com"))
+}
+
+func TestCaptureLogLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	level := func(config *JSONRendererConfig, header string) arbor.LogLevel {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/test", nil)
+		c.Request.RemoteAddr = "203.0.113.7:4321"
+		if header != "" {
+			c.Request.Header.Set(LOG_LEVEL_HEADER, header)
+		}
+		return captureLogLevel(c, config)
+	}
+
+	dev := &JSONRendererConfig{ServiceConfig: &ServiceConfig{Scope: "DEV"}}
+	prd := &JSONRendererConfig{ServiceConfig: &ServiceConfig{Scope: "PRD"}}
+	allowed := &JSONRendererConfig{
+		ServiceConfig: &ServiceConfig{Scope: "PRD"},
+		DebugPolicy:   &DebugPolicy{AllowedIPs: []string{"203.0.113.0/24"}},
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		assert.Equal(t, arbor.InfoLevel, level(nil, ""))
+		assert.Equal(t, arbor.WarnLevel, level(&JSONRendererConfig{ApiLogLevel: arbor.WarnLevel}, ""))
+	})
+
+	t.Run("DEV Scope", func(t *testing.T) {
+		assert.Equal(t, arbor.DebugLevel, level(dev, "debug"))
+		assert.Equal(t, arbor.TraceLevel, level(dev, "TRACE"))
+		assert.Equal(t, arbor.InfoLevel, level(dev, "verbose"))
+	})
+
+	t.Run("Only Authorized Outside DEV", func(t *testing.T) {
+		assert.Equal(t, arbor.InfoLevel, level(prd, "debug"))
+		assert.Equal(t, arbor.DebugLevel, level(allowed, "debug"))
+	})
+
+	t.Run("Ignored Without A Scope", func(t *testing.T) {
+		assert.Equal(t, arbor.InfoLevel, level(nil, "debug"))
+		assert.Equal(t, arbor.InfoLevel, level(&JSONRendererConfig{ServiceConfig: &ServiceConfig{Name: "test-service"}}, "debug"))
+	})
+
+	t.Run("Only Lowers The Level", func(t *testing.T) {
+		assert.Equal(t, arbor.InfoLevel, level(dev, "error"))
+		assert.Equal(t, arbor.InfoLevel, level(allowed, "off"))
+	})
+}
+
+func TestLogLevelHeaderMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger := arbor.Logger().WithMemoryWriter(models.WriterConfiguration{})
+
+	r := newTestRouter(nil, &JSONRendererConfig{
+		ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "PRD"},
+		DebugPolicy:   &DebugPolicy{AllowedIPs: []string{"203.0.113.7"}},
+	}, "/orders", func(c *gin.Context) {
+		requestLogger := logger.WithCorrelationId(GetCorrelationID(c))
+		WithLogger(c, requestLogger)
+		requestLogger.Debug().Msg("loading orders from cache")
+		requestLogger.Info().Msg("orders loaded")
+
+		c.JSON(http.StatusOK, gin.H{"orders": []int{1, 2}})
+	})
+
+	t.Run("Authorized", func(t *testing.T) {
+		w := serveTestRequest(r, "/orders?debug", withRemoteAddr("203.0.113.7:4321"),
+			withHeader("X-Correlation-ID", "log-level-authorized"), withHeader(LOG_LEVEL_HEADER, "debug"))
+		assert.Contains(t, w.Body.String(), "loading orders from cache")
+		assert.Contains(t, w.Body.String(), "orders loaded")
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		w := serveTestRequest(r, "/orders?debug", withRemoteAddr("198.51.100.1:4321"),
+			withHeader("X-Correlation-ID", "log-level-unauthorized"), withHeader(LOG_LEVEL_HEADER, "debug"))
+		assert.NotContains(t, w.Body.String(), "loading orders from cache")
+	})
+
+	t.Run("Without Header", func(t *testing.T) {
+		w := serveTestRequest(r, "/orders?debug", withRemoteAddr("203.0.113.7:4321"),
+			withHeader("X-Correlation-ID", "log-level-default"))
+		assert.NotContains(t, w.Body.String(), "loading orders from cache")
+		assert.Contains(t, w.Body.String(), "orders loaded")
+	})
+
+	t.Run("Provisioned Logger At Info", func(t *testing.T) {
+		// The memory writer drops debug entries, so only the request's log buffer can capture them
+		useMemoryWriter(t, &levelMemoryStore{MemoryLogStore: NewMemoryLogStore(MemoryLogStoreConfig{}), level: log.InfoLevel})
+
+		r := newTestRouter(nil, &JSONRendererConfig{
+			ServiceConfig:   &ServiceConfig{Name: "test-service", Scope: "DEV"},
+			DefaultLogger:   arbor.NewLogger(),
+			ProvisionLogger: true,
+		}, "/orders", func(c *gin.Context) {
+			GetRequestLogger(c).Debug().Msg("loading orders from cache")
+			GetRequestLogger(c).Info().Msg("orders loaded")
+			c.JSON(http.StatusOK, gin.H{"orders": []int{1, 2}})
+		})
+
+		body := serveTestRequest(r, "/orders", withHeader(LOG_LEVEL_HEADER, "debug")).Body.String()
+		assert.Contains(t, body, "loading orders from cache")
+		assert.Contains(t, body, "orders loaded")
+
+		body = serveTestRequest(r, "/orders").Body.String()
+		assert.NotContains(t, body, "loading orders from cache")
+		assert.Contains(t, body, "orders loaded")
+	})
+}
+
+// levelMemoryStore is a memory writer that drops entries below its level
+type levelMemoryStore struct {
+	*MemoryLogStore
+	level log.Level
+}
+
+func (s *levelMemoryStore) WithLevel(level log.Level) writers.IWriter {
+	s.level = level
+	return s
+}
+
+func (s *levelMemoryStore) Write(p []byte) (int, error) {
+	var event models.LogEvent
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	if event.Level < s.level {
+		return len(p), nil
+	}
+	return s.MemoryLogStore.Write(p)
+}
@@ -0,0 +1,382 @@
+// -----------------------------------------------------------------------
+// Memory Log Store
+// Bounded in-memory arbor memory writer with per-correlation purge and TTL
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+	"github.com/ternarybob/arbor/writers"
+)
+
+// DEFAULT_LOG_TTL is how long a correlation's logs are kept after its last write when MemoryLogStoreConfig.TTL is not set
+const DEFAULT_LOG_TTL = 10 * time.Minute
+
+// DEFAULT_MAX_LOG_ENTRIES is the per-correlation entry cap when MemoryLogStoreConfig.MaxEntries is not set
+const DEFAULT_MAX_LOG_ENTRIES = 1000
+
+// MemoryLogStoreConfig configures a MemoryLogStore
+type MemoryLogStoreConfig struct {
+	TTL        time.Duration // How long logs are kept after a correlation's last write (default: 10 minutes)
+	MaxEntries int           // Maximum entries kept per correlation ID, dropping the oldest (default: 1000)
+}
+
+// MemoryLogStats reports the entries a MemoryLogStore holds and has released
+type MemoryLogStats struct {
+	Correlations int    `json:"correlations"` // Correlation IDs with retained entries
+	Entries      int    `json:"entries"`      // Retained entries
+	Written      uint64 `json:"written"`      // Entries written since the store was created
+	Purged       uint64 `json:"purged"`       // Entries deleted by Purge
+	Expired      uint64 `json:"expired"`      // Entries deleted after their TTL
+	Dropped      uint64 `json:"dropped"`      // Entries dropped by the per-correlation cap
+}
+
+// MemoryLogStore is an arbor memory writer that keeps logs in memory by correlation ID
+// Unlike arbor's built-in memory writer, a correlation's logs can be deleted or expired
+// once its response is written (see LogRetentionConfig)
+// Usage: arbor.RegisterWriter(arbor.WRITER_MEMORY, omnis.NewMemoryLogStore(omnis.MemoryLogStoreConfig{}))
+type MemoryLogStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	logs       map[string]*correlationLogs
+	index      uint64
+	nextSweep  time.Time
+	stats      MemoryLogStats
+}
+
+// correlationLogs holds one correlation ID's entries, oldest first
+type correlationLogs struct {
+	events  []models.LogEvent
+	expires time.Time
+}
+
+// NewMemoryLogStore creates an empty store
+func NewMemoryLogStore(config MemoryLogStoreConfig) *MemoryLogStore {
+	store := &MemoryLogStore{
+		ttl:        config.TTL,
+		maxEntries: config.MaxEntries,
+		logs:       map[string]*correlationLogs{},
+	}
+	if store.ttl <= 0 {
+		store.ttl = DEFAULT_LOG_TTL
+	}
+	if store.maxEntries <= 0 {
+		store.maxEntries = DEFAULT_MAX_LOG_ENTRIES
+	}
+	return store
+}
+
+// WithLevel is a no-op: like arbor's memory writer, every entry is stored
+// and the minimum level is applied when entries are read
+func (s *MemoryLogStore) WithLevel(level log.Level) writers.IWriter {
+	return s
+}
+
+// Write stores an arbor log event; events without a correlation ID are ignored
+func (s *MemoryLogStore) Write(entry []byte) (int, error) {
+	if len(entry) == 0 {
+		return 0, nil
+	}
+
+	var event models.LogEvent
+	if err := json.Unmarshal(entry, &event); err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(event.CorrelationID) == "" {
+		return len(entry), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	s.index++
+	event.Index = s.index
+	s.stats.Written++
+
+	logs, exists := s.logs[event.CorrelationID]
+	if !exists {
+		logs = &correlationLogs{}
+		s.logs[event.CorrelationID] = logs
+	}
+	logs.events = append(logs.events, event)
+	logs.expires = now.Add(s.ttl)
+
+	if len(logs.events) > s.maxEntries {
+		dropped := len(logs.events) - s.maxEntries
+		logs.events = append(logs.events[:0:0], logs.events[dropped:]...)
+		s.stats.Dropped += uint64(dropped)
+	}
+
+	return len(entry), nil
+}
+
+// Purge deletes the logs of a correlation ID
+func (s *MemoryLogStore) Purge(correlationID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if logs, exists := s.logs[correlationID]; exists {
+		s.stats.Purged += uint64(len(logs.events))
+		delete(s.logs, correlationID)
+	}
+}
+
+// Expire deletes the logs of a correlation ID once ttl has passed, unless more are written
+func (s *MemoryLogStore) Expire(correlationID string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if logs, exists := s.logs[correlationID]; exists {
+		logs.expires = time.Now().Add(ttl)
+	}
+}
+
+// Stats returns the retained entry counts and release metrics, after removing expired logs
+func (s *MemoryLogStore) Stats() MemoryLogStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired(time.Now())
+
+	stats := s.stats
+	stats.Correlations = len(s.logs)
+	for _, logs := range s.logs {
+		stats.Entries += len(logs.events)
+	}
+	return stats
+}
+
+// sweep removes expired logs at most once a second, the caller holds the lock
+func (s *MemoryLogStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(time.Second)
+	s.removeExpired(now)
+}
+
+// removeExpired deletes the logs of correlations past their expiry, the caller holds the lock
+func (s *MemoryLogStore) removeExpired(now time.Time) {
+	for correlationID, logs := range s.logs {
+		if now.After(logs.expires) {
+			s.stats.Expired += uint64(len(logs.events))
+			delete(s.logs, correlationID)
+		}
+	}
+}
+
+// GetEntries returns a correlation's entries, keyed and formatted like arbor's memory writer
+func (s *MemoryLogStore) GetEntries(correlationID string) (map[string]string, error) {
+	return s.GetEntriesWithLevel(correlationID, log.TraceLevel)
+}
+
+// GetEntriesWithLevel returns a correlation's entries at or above the minimum level
+func (s *MemoryLogStore) GetEntriesWithLevel(correlationID string, minLevel log.Level) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := map[string]string{}
+	logs, exists := s.logs[correlationID]
+	if !exists || time.Now().After(logs.expires) {
+		return entries, nil
+	}
+
+	for i := range logs.events {
+		if logs.events[i].Level >= minLevel {
+			entries[formatLogIndex(logs.events[i].Index)] = formatLogEvent(&logs.events[i])
+		}
+	}
+	return entries, nil
+}
+
+// GetEventsWithLevel returns a correlation's log events at or above the minimum level, oldest first
+func (s *MemoryLogStore) GetEventsWithLevel(correlationID string, minLevel log.Level) []models.LogEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logs, exists := s.logs[correlationID]
+	if !exists || time.Now().After(logs.expires) {
+		return nil
+	}
+
+	events := make([]models.LogEvent, 0, len(logs.events))
+	for i := range logs.events {
+		if logs.events[i].Level >= minLevel {
+			events = append(events, logs.events[i])
+		}
+	}
+	return events
+}
+
+// GetAllEntries returns every retained entry, keyed by correlation ID and index
+func (s *MemoryLogStore) GetAllEntries() (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := map[string]string{}
+	now := time.Now()
+	for correlationID, logs := range s.logs {
+		if now.After(logs.expires) {
+			continue
+		}
+		for i := range logs.events {
+			entries[fmt.Sprintf("%s:%010d", correlationID, logs.events[i].Index)] = formatLogEvent(&logs.events[i])
+		}
+	}
+	return entries, nil
+}
+
+// GetStoredCorrelationIDs returns the correlation IDs with retained entries
+func (s *MemoryLogStore) GetStoredCorrelationIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.logs))
+	now := time.Now()
+	for correlationID, logs := range s.logs {
+		if !now.After(logs.expires) {
+			ids = append(ids, correlationID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetEntriesWithLimit returns the most recent entries across all correlation IDs
+func (s *MemoryLogStore) GetEntriesWithLimit(limit int) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []*models.LogEvent{}
+	now := time.Now()
+	for _, logs := range s.logs {
+		if now.After(logs.expires) {
+			continue
+		}
+		for i := range logs.events {
+			events = append(events, &logs.events[i])
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Index > events[j].Index })
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+
+	entries := make(map[string]string, len(events))
+	for _, event := range events {
+		entries[formatLogIndex(event.Index)] = formatLogEvent(event)
+	}
+	return entries, nil
+}
+
+// Close deletes all retained logs
+func (s *MemoryLogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logs = map[string]*correlationLogs{}
+	return nil
+}
+
+// formatLogIndex formats an entry index like arbor's memory writer: zero-padded to three digits
+func formatLogIndex(index uint64) string {
+	return fmt.Sprintf("%03d", index)
+}
+
+// formatLogEvent formats an entry like arbor's memory writer: "LVL|time|prefix|message|error"
+func formatLogEvent(event *models.LogEvent) string {
+	return formatLogLine(event.Level, event.Timestamp, event.Prefix, event.Message, event.Error)
+}
+
+// formatLogLine formats the parts of an entry like arbor's memory writer, omitting empty parts
+func formatLogLine(level log.Level, timestamp time.Time, prefix string, message string, err string) string {
+	abbreviation := "INF"
+	switch level {
+	case log.TraceLevel:
+		abbreviation = "TRC"
+	case log.DebugLevel:
+		abbreviation = "DBG"
+	case log.WarnLevel:
+		abbreviation = "WRN"
+	case log.ErrorLevel:
+		abbreviation = "ERR"
+	case log.FatalLevel:
+		abbreviation = "FTL"
+	case log.PanicLevel:
+		abbreviation = "PNC"
+	}
+
+	output := abbreviation + "|" + timestamp.Format(time.Stamp)
+	if prefix != "" {
+		output += "|" + prefix
+	}
+	if message != "" {
+		output += "|" + message
+	}
+	if err != "" {
+		output += "|" + err
+	}
+	return output
+}
+
+// registeredMemoryLogStore returns the registered arbor memory writer when it is a MemoryLogStore, or nil
+func registeredMemoryLogStore() *MemoryLogStore {
+	store, _ := arbor.GetRegisteredMemoryWriter(arbor.WRITER_MEMORY).(*MemoryLogStore)
+	return store
+}
+
+// LogRetentionConfig releases a request's memory logs once its response is written
+// The logs must be held by a MemoryLogStore: arbor's built-in memory writer cannot delete entries
+// and keeps them for its own 10 minute TTL
+type LogRetentionConfig struct {
+	Store *MemoryLogStore // Store holding the logs (default: the registered arbor memory writer, when it is a MemoryLogStore)
+	TTL   time.Duration   // Keep the logs this long after the response, e.g. for follow-up debugging (default: delete immediately)
+}
+
+// releaseMemoryLogs purges or expires the request's memory logs after its response is written
+// Responses left for an outer ErrorHandler to render keep their logs, as do panics handled by Recovery.
+// Only correlation IDs generated by omnis or accepted by a correlation policy are released: a caller's
+// ID used verbatim may be another in-flight request's, whose logs must not be deleted
+func releaseMemoryLogs(c *gin.Context, writer gin.ResponseWriter, config *JSONRendererConfig) {
+	if config == nil || config.LogRetention == nil {
+		return
+	}
+	if writer.Size() <= 0 && len(c.Errors) > 0 {
+		return
+	}
+
+	correlationID := c.GetString(CORRELATION_ID_KEY)
+	if correlationID == "" || !c.GetBool(CORRELATION_ID_OWNED) {
+		return
+	}
+
+	store := config.LogRetention.Store
+	if store == nil {
+		store = registeredMemoryLogStore()
+	}
+	if store == nil {
+		return
+	}
+
+	if config.LogRetention.TTL > 0 {
+		store.Expire(correlationID, config.LogRetention.TTL)
+	} else {
+		store.Purge(correlationID)
+	}
+}
@@ -0,0 +1,241 @@
+// -----------------------------------------------------------------------
+// Memory Log Store Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+)
+
+func TestMemoryLogStore(t *testing.T) {
+	write := func(store *MemoryLogStore, correlationID string, level log.Level, message string) {
+		data, err := json.Marshal(models.LogEvent{
+			Level:         level,
+			Timestamp:     time.Date(2025, time.October, 16, 15, 11, 14, 0, time.Local),
+			CorrelationID: correlationID,
+			Prefix:        "API",
+			Message:       message,
+		})
+		require.NoError(t, err)
+		_, err = store.Write(data)
+		require.NoError(t, err)
+	}
+
+	t.Run("Entries", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		write(store, "store-a", log.DebugLevel, "loading")
+		write(store, "store-a", log.InfoLevel, "loaded")
+		write(store, "store-b", log.WarnLevel, "slow")
+		write(store, "", log.InfoLevel, "ignored without a correlation ID")
+
+		entries, err := store.GetEntries("store-a")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"001": "DBG|Oct 16 15:11:14|API|loading",
+			"002": "INF|Oct 16 15:11:14|API|loaded",
+		}, entries)
+
+		entries, err = store.GetEntriesWithLevel("store-a", log.InfoLevel)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		entries, err = store.GetEntriesWithLimit(2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"002", "003"}, sortedLogKeys(entries))
+
+		all, err := store.GetAllEntries()
+		require.NoError(t, err)
+		assert.Len(t, all, 3)
+		assert.Equal(t, []string{"store-a", "store-b"}, store.GetStoredCorrelationIDs())
+	})
+
+	t.Run("Entry Cap", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{MaxEntries: 2})
+		for i := 1; i <= 5; i++ {
+			write(store, "store-cap", log.InfoLevel, fmt.Sprintf("entry %d", i))
+		}
+
+		entries, err := store.GetEntries("store-cap")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"004": "INF|Oct 16 15:11:14|API|entry 4",
+			"005": "INF|Oct 16 15:11:14|API|entry 5",
+		}, entries)
+		assert.Equal(t, MemoryLogStats{Correlations: 1, Entries: 2, Written: 5, Dropped: 3}, store.Stats())
+	})
+
+	t.Run("Purge And Expire", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		write(store, "store-purge", log.InfoLevel, "one")
+		write(store, "store-purge", log.InfoLevel, "two")
+		write(store, "store-expire", log.InfoLevel, "three")
+
+		store.Purge("store-purge")
+		store.Expire("store-expire", 10*time.Millisecond)
+
+		entries, err := store.GetEntries("store-expire")
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		time.Sleep(20 * time.Millisecond)
+		entries, err = store.GetEntries("store-expire")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		assert.Equal(t, MemoryLogStats{Written: 3, Purged: 2, Expired: 1}, store.Stats())
+	})
+
+	t.Run("Envelope Entries From Events", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		useMemoryWriter(t, store)
+
+		// No prefix, a '|' in the message, an error, a field and the caller
+		data, err := json.Marshal(models.LogEvent{
+			Level:         log.WarnLevel,
+			Timestamp:     time.Date(2025, time.October, 16, 15, 11, 14, 0, time.UTC),
+			CorrelationID: "store-events",
+			Message:       "retrying a|b",
+			Error:         "timeout",
+			Function:      "orders.Place",
+			Fields:        map[string]interface{}{"attempt": float64(2)},
+		})
+		require.NoError(t, err)
+		_, err = store.Write(data)
+		require.NoError(t, err)
+
+		logs := memoryLogs(arbor.Logger(), "store-events", arbor.InfoLevel, &JSONRendererConfig{LogFormat: LOG_FORMAT_STRUCTURED})
+		assert.Equal(t, []LogEntry{{
+			Index:     "001",
+			Level:     "warn",
+			Timestamp: time.Date(2025, time.October, 16, 15, 11, 14, 0, time.UTC),
+			Message:   "retrying a|b",
+			Fields:    map[string]interface{}{"attempt": float64(2), "error": "timeout"},
+			Caller:    "orders.Place",
+		}}, logs["entries"])
+
+		logs = memoryLogs(arbor.Logger(), "store-events", arbor.InfoLevel, &JSONRendererConfig{MaxLogMessageLength: 8})
+		assert.Equal(t, map[string]string{"001": "WRN|Oct 16 15:11:14|retrying…|timeout"}, logs["entries"])
+
+		logs = memoryLogs(arbor.Logger(), "store-events", arbor.ErrorLevel, nil)
+		assert.Equal(t, "request logger set but no logs captured for correlation ID", logs["status"])
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{TTL: 10 * time.Millisecond})
+		write(store, "store-ttl", log.InfoLevel, "short lived")
+
+		time.Sleep(20 * time.Millisecond)
+		assert.Empty(t, store.GetStoredCorrelationIDs())
+		assert.Equal(t, uint64(1), store.Stats().Expired)
+	})
+}
+
+func TestLogRetentionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger := arbor.Logger()
+
+	// Callers' IDs are only released when a correlation policy accepts them
+	newRouter := func(retention *LogRetentionConfig, policy *CorrelationPolicy) *gin.Engine {
+		return newTestRouter(&CorrelationConfig{Policy: policy}, &JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "DEV"},
+			LogRetention:  retention,
+		}, "/work", func(c *gin.Context) {
+			requestLogger := logger.WithCorrelationId(GetCorrelationID(c))
+			WithLogger(c, requestLogger)
+			requestLogger.Info().Msg("step one")
+			requestLogger.Info().Msg("step two")
+			requestLogger.Warn().Msg("step three")
+
+			c.JSON(http.StatusOK, gin.H{"done": true})
+		})
+	}
+
+	t.Run("Bounded Over Many Requests", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		useMemoryWriter(t, store)
+		r := newRouter(&LogRetentionConfig{}, &CorrelationPolicy{})
+
+		for i := 0; i < 500; i++ {
+			w := serveTestRequest(r, "/work", withHeader("X-Correlation-ID", fmt.Sprintf("retention-purge-%d", i)))
+			// Logs are purged after the envelope is rendered, not before
+			require.Contains(t, w.Body.String(), "step three")
+			require.Zero(t, store.Stats().Entries)
+		}
+
+		stats := store.Stats()
+		assert.Equal(t, 0, stats.Correlations)
+		// The handler's three entries and the renderer's own debug entry, for each request
+		assert.Equal(t, uint64(2000), stats.Written)
+		assert.Equal(t, stats.Written, stats.Purged)
+	})
+
+	t.Run("Unbounded Without Retention", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		useMemoryWriter(t, store)
+		r := newRouter(nil, &CorrelationPolicy{})
+
+		for i := 0; i < 100; i++ {
+			serveTestRequest(r, "/work", withHeader("X-Correlation-ID", fmt.Sprintf("retention-none-%d", i)))
+		}
+
+		stats := store.Stats()
+		assert.Equal(t, 100, stats.Correlations)
+		assert.Equal(t, 400, stats.Entries)
+	})
+
+	t.Run("TTL After Response", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		useMemoryWriter(t, store)
+		r := newRouter(&LogRetentionConfig{Store: store, TTL: 20 * time.Millisecond}, &CorrelationPolicy{})
+
+		serveTestRequest(r, "/work", withHeader("X-Correlation-ID", "retention-ttl"))
+		assert.Equal(t, 4, store.Stats().Entries)
+
+		time.Sleep(40 * time.Millisecond)
+		stats := store.Stats()
+		assert.Equal(t, 0, stats.Entries)
+		assert.Equal(t, uint64(4), stats.Expired)
+	})
+
+	t.Run("Generated IDs Released", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		useMemoryWriter(t, store)
+
+		serveTestRequest(newRouter(&LogRetentionConfig{}, nil), "/work")
+		assert.Zero(t, store.Stats().Entries)
+	})
+
+	t.Run("Verbatim IDs Kept", func(t *testing.T) {
+		store := NewMemoryLogStore(MemoryLogStoreConfig{})
+		useMemoryWriter(t, store)
+		r := newRouter(&LogRetentionConfig{}, nil)
+
+		// A request still in flight when another arrives with its correlation ID
+		r.GET("/slow", func(c *gin.Context) {
+			requestLogger := logger.WithCorrelationId(GetCorrelationID(c))
+			WithLogger(c, requestLogger)
+			requestLogger.Warn().Msg("slow step")
+
+			serveTestRequest(r, "/work", withHeader("X-Correlation-ID", GetCorrelationID(c)))
+			c.JSON(http.StatusOK, gin.H{"done": true})
+		})
+
+		w := serveTestRequest(r, "/slow", withHeader("X-Correlation-ID", "retention-shared"))
+
+		// The second request did not purge the first request's logs
+		assert.Contains(t, w.Body.String(), "slow step")
+		assert.NotZero(t, store.Stats().Entries)
+	})
+}
@@ -1,41 +1,104 @@
 package omnis
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
-type gincorrelation struct {
-	ctx gin.Context
+// CorrelationConfig configures SetCorrelationIDWithConfig
+type CorrelationConfig struct {
+	Propagator IPropagator        // Headers read and written, DefaultPropagator() if nil
+	Generator  IGenerator         // Generates IDs the caller did not send, UUIDv4Generator() if nil
+	Policy     *CorrelationPolicy // Validates IDs the caller sent (default: used verbatim)
 }
 
+// SetCorrelationID sets the request's correlation ID and W3C trace context
+// A valid traceparent header continues the caller's trace with a new span for this hop, and its
+// trace ID becomes the correlation ID when no X-Correlation-ID is sent; otherwise a new trace starts.
+// The correlation ID and this hop's traceparent (and any tracestate) are set on the response
 func SetCorrelationID() gin.HandlerFunc {
+	return SetCorrelationIDWithPropagator(DefaultPropagator())
+}
+
+// SetCorrelationIDWithPropagator sets the request's correlation ID and trace context from the headers
+// the propagator reads, such as B3 or Jaeger, and writes its headers on the response.
+// The correlation ID is always set in X-Correlation-ID on the response, as SetCorrelationID does
+// Usage: r.Use(omnis.SetCorrelationIDWithPropagator(omnis.CompositePropagator(omnis.W3CPropagator(), omnis.B3Propagator())))
+func SetCorrelationIDWithPropagator(propagator IPropagator) gin.HandlerFunc {
+	return SetCorrelationIDWithConfig(&CorrelationConfig{Propagator: propagator})
+}
+
+// SetCorrelationIDWithConfig sets the request's correlation ID and trace context as SetCorrelationIDWithPropagator
+// does, generating missing correlation IDs with the configured generator
+// Usage: r.Use(omnis.SetCorrelationIDWithConfig(&omnis.CorrelationConfig{Generator: omnis.ULIDGenerator()}))
+func SetCorrelationIDWithConfig(config *CorrelationConfig) gin.HandlerFunc {
+	propagator := DefaultPropagator()
+	generator := UUIDv4Generator()
+	var policy *CorrelationPolicy
+	if config != nil {
+		policy = config.Policy
+		if config.Propagator != nil {
+			propagator = config.Propagator
+		}
+		if config.Generator != nil {
+			generator = config.Generator
+		}
+	}
+
 	return func(ctx *gin.Context) {
+		incoming, _ := propagator.Extract(ctx.Request.Header)
+
 		// Check if correlation ID already exists in context
 		correlationID := ctx.GetString(CORRELATION_ID_KEY)
 
-		// If not in context, check for X-Correlation-ID header
-		if correlationID == "" {
-			correlationID = ctx.GetHeader("X-Correlation-ID")
+		// An ID already in context keeps its ownership
+		owned := ctx.GetBool(CORRELATION_ID_OWNED)
+
+		// If not in context, use the one sent by the caller if the policy accepts it
+		// Only a policy makes a caller's ID ours; without one it is used verbatim
+		var invalid error
+		if correlationID == "" && incoming.CorrelationID != "" {
+			var accepted bool
+			if accepted, invalid = policy.accept(ctx, incoming.CorrelationID); accepted {
+				correlationID = incoming.CorrelationID
+				owned = policy != nil
+			}
 		}
 
-		// If still empty, generate a new UUID
-		if correlationID == "" {
-			uuidValue, err := uuid.NewRandom()
-			if err != nil {
-				// Fallback to a simple UUID string if generation fails
-				correlationID = uuid.New().String()
-			} else {
-				correlationID = uuidValue.String()
+		// Continue the caller's trace, or start one, unless an earlier middleware already did
+		trace, exists := GetTraceContext(ctx)
+		if !exists {
+			trace = childTraceContext(incoming.Trace)
+		}
+
+		// If not sent, link the correlation ID to the caller's trace, when the policy would accept
+		// the trace ID from this caller as its correlation ID
+		if correlationID == "" && incoming.CorrelationID == "" && trace.ParentSpanID != "" {
+			if exists || (policy.Trusted(ctx) && policy.Validate(trace.TraceID) == nil) {
+				correlationID = trace.TraceID
+				owned = !exists && policy != nil
 			}
 		}
 
-		// Set correlation ID in context
-		ctx.Set(CORRELATION_ID_KEY, correlationID)
+		// If still empty, generate one
+		if correlationID == "" {
+			correlationID = newCorrelationID(generator)
+			owned = true
+		}
+
+		setCorrelationID(ctx, correlationID, owned)
+
+		// Set this hop's trace context in context and the propagator's response headers
+		ctx.Set(TRACE_CONTEXT_KEY, trace)
+		ctx.Set(PROPAGATOR_KEY, propagator)
+		propagator.Inject(PropagationContext{CorrelationID: correlationID, Trace: trace}, ctx.Writer.Header())
 
-		// Set correlation ID in response headers (both formats for compatibility)
-		ctx.Header("X-Correlation-ID", correlationID)
-		ctx.Header(CORRELATION_ID_KEY, correlationID)
+		// Reject an invalid correlation ID once the request has its own
+		if invalid != nil && policy.Reject {
+			policy.reject(ctx, invalid)
+			return
+		}
 
 		// Continue to next middleware
 		ctx.Next()
@@ -55,14 +118,10 @@ func GetCorrelationID(c *gin.Context) string {
 	}
 
 	// Fallback: check headers
-	correlationID = c.GetHeader("X-Correlation-ID")
-	if correlationID != "" {
-		return correlationID
-	}
-
-	correlationID = c.GetHeader(CORRELATION_ID_KEY)
-	if correlationID != "" {
-		return correlationID
+	if c.Request != nil {
+		if incoming, ok := requestPropagator(c).Extract(c.Request.Header); ok && incoming.CorrelationID != "" {
+			return incoming.CorrelationID
+		}
 	}
 
 	return "unknown"
@@ -72,21 +131,24 @@ func GetCorrelationID(c *gin.Context) string {
 func GetCorrelationIDOrGenerate(c *gin.Context) string {
 	correlationID := GetCorrelationID(c)
 	if correlationID == "unknown" {
-		// Generate a new correlation ID
-		uuidValue, err := uuid.NewRandom()
-		if err != nil {
-			// Fallback to simple UUID generation
-			correlationID = uuid.New().String()
-		} else {
-			correlationID = uuidValue.String()
-		}
+		correlationID = newCorrelationID(UUIDv4Generator())
 
 		// Set it in context and headers if context is available
 		if c != nil {
-			c.Set(CORRELATION_ID_KEY, correlationID)
-			c.Header("X-Correlation-ID", correlationID)
-			c.Header(CORRELATION_ID_KEY, correlationID)
+			setCorrelationID(c, correlationID, true)
 		}
 	}
 	return correlationID
 }
+
+// setCorrelationID sets the correlation ID in the gin and request contexts and in the response headers
+// (both formats for compatibility). owned marks an ID generated by omnis or accepted by a policy
+func setCorrelationID(c *gin.Context, correlationID string, owned bool) {
+	c.Set(CORRELATION_ID_KEY, correlationID)
+	c.Set(CORRELATION_ID_OWNED, owned)
+	setRequestContext(c, func(ctx context.Context) context.Context {
+		return ContextWithCorrelationID(ctx, correlationID)
+	})
+	c.Header(CORRELATION_ID_HEADER, correlationID)
+	c.Header(CORRELATION_ID_KEY, correlationID)
+}
@@ -1,30 +1,141 @@
 package omnis
 
-// func ErrorHandler() echo.HandlerFunc {
+import (
+	"net/http"
+	"strings"
 
-// 	return func(ctx echo.Context) error {
+	"github.com/gin-gonic/gin"
+)
 
-// 		log := defaultLogger().WithRequestContext(ctx).GetLogger().Level(zerolog.DebugLevel)
+// ErrorHandler -> renders errors added to the gin context (c.Error / c.AbortWithError) as an ApiResponse
+// Usage: router.Use(omnis.ErrorHandler())
+func ErrorHandler() gin.HandlerFunc {
+	return ErrorHandlerWithConfig(nil)
+}
 
-// 		err := ctx.Errors.Last()
+// ErrorHandlerWithConfig renders context errors using the renderer configuration for the
+// service metadata and the fallback logger when no request logger is set
+//
+// The status is taken from the handler when it set one (>= 400), otherwise bind errors
+// map to 400 and anything else to 500. Public and bind error messages are always returned;
+// private error messages are only returned in DEV scope, otherwise the status text is.
+// Without a config, the JSONMiddleware configuration of the request is used.
+func ErrorHandlerWithConfig(config *JSONRendererConfig) gin.HandlerFunc {
 
-// 		if err == nil {
-// 			ctx.Next()
-// 			return nil
-// 		}
+	return func(ctx *gin.Context) {
 
-// 		log.Debug().Msg("Errors Detected")
+		// Hold back headers committed without a body (c.AbortWithError / c.AbortWithStatus),
+		// so the error body can still set its Content-Type
+		writer := &errorResponseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		defer func() {
+			ctx.Writer = writer.ResponseWriter
+			writer.commit()
+		}()
 
-// 		render := RenderService(ctx)
+		ctx.Next()
 
-// 		log.Warn().Err(err).Msg("")
+		if len(ctx.Errors) == 0 {
+			return
+		}
 
-// 		render.AsError(http.StatusInternalServerError, err)
+		// Without its own config, the error handler renders with the JSONMiddleware configuration, if any
+		renderer := config
+		if renderer == nil {
+			renderer = getRendererConfig(ctx)
+		}
 
-// 		ctx.Abort()
+		var serviceConfig *ServiceConfig
+		if renderer != nil {
+			serviceConfig = renderer.ServiceConfig
+		}
 
-// 		return nil
+		logger := resolveLogger(ctx, renderer)
 
-// 	}
+		if logger != nil {
+			logger.Debug().Int("count", len(ctx.Errors)).Msg("Errors Detected")
+			for _, err := range ctx.Errors {
+				logger.Warn().Err(err.Err).Msg("")
+			}
+		} else {
+			log := warnLogger()
+			log.Warn().Strs("errors", ctx.Errors.Errors()).Msg("Errors Detected")
+		}
 
-// }
+		// The handler already wrote a body - leave it untouched
+		// A status alone (c.AbortWithError / c.AbortWithStatus) still gets the error body
+		if ctx.Writer.Size() > 0 {
+			return
+		}
+
+		status := errorStatus(ctx)
+
+		message := errorMessage(ctx.Errors, hasDevScope(serviceConfig))
+		if message == "" {
+			message = http.StatusText(status)
+		}
+
+		render := &renderservice{
+			ctx:      ctx,
+			config:   serviceConfig,
+			logger:   logger,
+			renderer: renderer,
+		}
+
+		response := render.newResponse(status)
+		response.Error = message
+
+		render.render(status, response)
+
+		ctx.Abort()
+
+	}
+
+}
+
+// errorResponseWriter defers committing the headers until a body is written or the handler finishes
+type errorResponseWriter struct {
+	gin.ResponseWriter
+	pending bool
+}
+
+// WriteHeaderNow records that the headers should be committed, without committing them yet
+func (w *errorResponseWriter) WriteHeaderNow() {
+	if !w.ResponseWriter.Written() {
+		w.pending = true
+	}
+}
+
+// commit writes the deferred headers, unless a body has been written since
+func (w *errorResponseWriter) commit() {
+	if w.pending {
+		w.pending = false
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// errorStatus picks the response status for the context errors
+func errorStatus(ctx *gin.Context) int {
+	// Respect a status set by the handler, e.g. c.AbortWithError(http.StatusNotFound, err)
+	if status := ctx.Writer.Status(); status >= http.StatusBadRequest {
+		return status
+	}
+
+	if len(ctx.Errors.ByType(gin.ErrorTypeBind)) > 0 {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// errorMessage joins the messages of the errors that may be shown to the client
+func errorMessage(errs []*gin.Error, dev bool) string {
+	messages := []string{}
+	for _, err := range errs {
+		if dev || err.IsType(gin.ErrorTypePublic) || err.IsType(gin.ErrorTypeBind) {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	return strings.Join(messages, "; ")
+}
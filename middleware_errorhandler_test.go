@@ -0,0 +1,146 @@
+// -----------------------------------------------------------------------
+// Error Handler Middleware Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Private Error in DEV", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(ErrorHandlerWithConfig(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "DEV"},
+		}))
+
+		r.GET("/error", func(c *gin.Context) {
+			c.Error(errors.New("database unavailable"))
+		})
+
+		w := serveTestRequest(r, "/error", withHeader("X-Correlation-ID", "error-handler-test"))
+		response := decodeTestResponse[ApiResponse](t, w)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, "database unavailable", response.Error)
+		assert.Equal(t, "error-handler-test", response.CorrelationId)
+		assert.Equal(t, "test-service", response.Name)
+	})
+
+	t.Run("Private Error Hidden Outside DEV", func(t *testing.T) {
+		r := gin.New()
+		r.Use(ErrorHandlerWithConfig(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "PRD"},
+		}))
+
+		r.GET("/error", func(c *gin.Context) {
+			c.Error(errors.New("database unavailable"))
+		})
+
+		w := serveTestRequest(r, "/error", withHeader("X-Correlation-ID", "error-handler-test"))
+		response := decodeTestResponse[ApiResponse](t, w)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusText(http.StatusInternalServerError), response.Error)
+	})
+
+	t.Run("Private Error Hidden With JSONMiddleware Config", func(t *testing.T) {
+		r := gin.New()
+		r.Use(ErrorHandler())
+		r.Use(JSONMiddleware(&ServiceConfig{Name: "test-service", Scope: "PRD"}))
+
+		r.GET("/error", func(c *gin.Context) {
+			c.Error(errors.New("pq: password authentication failed for user admin"))
+		})
+
+		w := serveTestRequest(r, "/error", withHeader("X-Correlation-ID", "error-handler-test"))
+		response := decodeTestResponse[ApiResponse](t, w)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusText(http.StatusInternalServerError), response.Error)
+		assert.Equal(t, "test-service", response.Name)
+		assert.Nil(t, response.Request)
+		assert.NotContains(t, w.Body.String(), "password authentication")
+	})
+
+	t.Run("Private Error Hidden Without A Scope", func(t *testing.T) {
+		r := gin.New()
+		r.Use(ErrorHandler())
+
+		r.GET("/error", func(c *gin.Context) {
+			c.Error(errors.New("database unavailable"))
+		})
+
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/error"))
+		assert.Equal(t, http.StatusText(http.StatusInternalServerError), response.Error)
+	})
+
+	t.Run("Public Error With Handler Status", func(t *testing.T) {
+		r := gin.New()
+		r.Use(ErrorHandlerWithConfig(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "PRD"},
+		}))
+
+		r.GET("/missing", func(c *gin.Context) {
+			c.AbortWithError(http.StatusNotFound, errors.New("user not found")).SetType(gin.ErrorTypePublic)
+		})
+
+		w := serveTestRequest(r, "/missing", withHeader("X-Correlation-ID", "error-handler-test"))
+		response := decodeTestResponse[ApiResponse](t, w)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		// The headers committed by AbortWithError are held back until the error body is written
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, http.StatusNotFound, response.Status)
+		assert.Equal(t, "user not found", response.Error)
+	})
+
+	t.Run("Bind Error Maps to Bad Request", func(t *testing.T) {
+		r := gin.New()
+		r.Use(ErrorHandler())
+
+		r.GET("/bind", func(c *gin.Context) {
+			c.Error(errors.New("field 'name' is required")).SetType(gin.ErrorTypeBind)
+		})
+
+		w := serveTestRequest(r, "/bind", withHeader("X-Correlation-ID", "error-handler-test"))
+		response := decodeTestResponse[ApiResponse](t, w)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "field 'name' is required", response.Error)
+	})
+
+	t.Run("Existing Response Untouched", func(t *testing.T) {
+		r := gin.New()
+		r.Use(ErrorHandler())
+
+		r.GET("/written", func(c *gin.Context) {
+			c.Error(errors.New("logged only"))
+			c.String(http.StatusAccepted, "accepted")
+		})
+
+		w := serveTestRequest(r, "/written")
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, "accepted", w.Body.String())
+	})
+
+	t.Run("No Errors Passes Through", func(t *testing.T) {
+		r := gin.New()
+		r.Use(ErrorHandler())
+
+		r.GET("/ok", func(c *gin.Context) {
+			c.String(http.StatusOK, "ok")
+		})
+
+		w := serveTestRequest(r, "/ok")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", w.Body.String())
+	})
+}
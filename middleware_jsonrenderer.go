@@ -7,8 +7,13 @@
 package omnis
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -17,11 +22,25 @@ import (
 
 // JSONRendererConfig holds configuration for the JSON renderer middleware
 type JSONRendererConfig struct {
-	ServiceConfig     *ServiceConfig // Service configuration
-	DefaultLogger     arbor.ILogger  // Default logger to use if none specified
-	EnablePrettyPrint bool           // Enable pretty printing in development
-	ApiLogLevel       arbor.LogLevel // Minimum log level for capturing logs (default: InfoLevel)
-	ResponseFormat    string         // Response format: "apiresponse" (default) or "standard"
+	ServiceConfig       *ServiceConfig        // Service configuration
+	DefaultLogger       arbor.ILogger         // Default logger to use if none specified
+	EnablePrettyPrint   bool                  // Enable pretty printing in development
+	ApiLogLevel         arbor.LogLevel        // Minimum log level for capturing logs (default: InfoLevel); X-Omnis-Log-Level lowers it only as far as the request logger's writers keep entries, unless ProvisionLogger or LogBufferSize buffers them
+	ResponseFormat      string                // Response format: "apiresponse" (default), "standard", "problem" or "jsonapi"
+	SuccessFormat       string                // Success response format when ResponseFormat is "problem": "apiresponse" (default) or "standard"
+	NegotiateFormat     bool                  // Negotiate the envelope media type from the Accept header (default: JSON envelopes for JSON bodies only)
+	NotAcceptableAsJSON bool                  // With NegotiateFormat, send a JSON envelope instead of a 406 when no encoder is acceptable
+	Encoders            *EncoderRegistry      // Envelope encoders negotiated from the Accept header (default: JSON, XML, YAML, MessagePack, CBOR)
+	JSONEncoder         IJSONEncoder          // JSON library for envelopes: StdJSON (default), SonicJSON or GoccyJSON
+	DebugPolicy         *DebugPolicy          // Authorizes ?debug outside DEV scope (default: ?debug only works in DEV)
+	Redactor            *Redactor             // Masks sensitive values in logs, request details and optionally results
+	RequestCapture      *RequestCaptureConfig // Request details in ApiResponse.Request, DEV scope or debug mode only (default: method, url, route)
+	LogFormat           string                // Captured log format: "legacy" (default) or "structured"
+	MaxLogEntries       int                   // Maximum captured log entries, keeping the most recent (default: unlimited)
+	MaxLogMessageLength int                   // Maximum characters per captured log message (default: unlimited)
+	ProvisionLogger     bool                  // Derive a request logger from DefaultLogger for each request with a correlation ID
+	LogRetention        *LogRetentionConfig   // Delete or expire the request's memory logs once its response is written (default: kept)
+	LogBufferSize       int                   // Capture logs in a per-request LogBuffer of this many entries instead of memory logs (default: off)
 }
 
 // Note: JSONRenderer struct removed - functionality replaced by:
@@ -38,247 +57,621 @@ func JSONMiddleware(config *ServiceConfig) gin.HandlerFunc {
 
 // JSONMiddlewareWithConfig creates middleware with full configuration options
 // This middleware intercepts all c.JSON() calls and enhances them with logging
+// The response body is buffered until the handler chain finishes, then wrapped and written once
 // Usage: router.Use(omnis.JSONMiddlewareWithConfig(&omnis.JSONRendererConfig{...}))
 func JSONMiddlewareWithConfig(config *JSONRendererConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Create custom response writer that intercepts JSON responses
-		originalWriter := c.Writer
-		interceptor := &jsonResponseInterceptor{
-			ResponseWriter: originalWriter,
-			context:        c,
-			config:         config,
-		}
+		interceptor := newJSONResponseInterceptor(c, config)
 		c.Writer = interceptor
 
+		completed := false
+		defer func() {
+			if !completed {
+				// The chain panicked - drop the partial body and hand the original
+				// writer back so recovery middleware can render the error
+				c.Writer = interceptor.ResponseWriter
+			}
+		}()
+
+		// Let RenderService render with the same configuration
+		if config != nil {
+			c.Set(RENDERER_CONFIG, config)
+		}
+
+		// Capture the start of the request body before handlers consume it, when configured
+		captureRequestBody(c, config)
+
+		// Give handlers a request logger so logs are captured without omnis.WithLogger, when configured
+		provisionRequestLogger(c, config)
+
+		// Capture the request's logs in its own buffer, whatever the global logging setup, when configured
+		attachLogBuffer(c, config)
+
 		// Note: No longer storing JSONRenderer in context
 		// Functionality moved to Gin extensions and automatic interception
 		c.Next()
+
+		completed = true
+		interceptor.finish()
+		c.Writer = interceptor.ResponseWriter
+
+		// The envelope has been written, so the request's memory logs can be released, when configured
+		releaseMemoryLogs(c, c.Writer, config)
+	}
+}
+
+// provisionRequestLogger stores a copy of the default logger, tagged with the request's correlation ID,
+// as the request logger. Copy keeps the writers but not the default logger's context, such as its prefix.
+// Requests without a correlation ID (see SetCorrelationID) or with a request logger already set are left alone
+func provisionRequestLogger(c *gin.Context, config *JSONRendererConfig) {
+	if config == nil || !config.ProvisionLogger || config.DefaultLogger == nil {
+		return
+	}
+	if _, exists := c.Get(REQUEST_LOGGER); exists {
+		return
+	}
+
+	correlationID := c.GetString(CORRELATION_ID_KEY)
+	if correlationID == "" {
+		return
+	}
+
+	// The logger's writers may drop entries below their own level, so a request lowering the capture level
+	// with X-Omnis-Log-Level gets a log buffer, which receives the logger's entries at every level
+	if config.LogBufferSize <= 0 && captureLogLevel(c, config) < apiLogLevel(config) {
+		c.Set(LOG_BUFFER, NewLogBuffer(0))
+	}
+
+	WithLogger(c, config.DefaultLogger.Copy().WithCorrelationId(correlationID))
+}
+
+// SkipEnvelope marks the route so its response body is written without an envelope
+// Usage: router.GET("/raw", omnis.SkipEnvelope(), handler)
+func SkipEnvelope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(SKIP_ENVELOPE, true)
+		c.Next()
 	}
 }
 
 // jsonResponseInterceptor intercepts JSON responses and enhances them
+// JSON bodies, and with NegotiateFormat also XML, YAML, MessagePack, CBOR and protobuf bodies,
+// are buffered and written by finish; anything else is written through
 type jsonResponseInterceptor struct {
 	gin.ResponseWriter
-	context *gin.Context
-	config  *JSONRendererConfig
-	written bool
+	context     *gin.Context
+	config      *JSONRendererConfig
+	body        bytes.Buffer
+	passthrough bool // Unsupported, flushed or hijacked responses are written through unchanged
+	finished    bool
+	value       interface{} // Unencoded response value, when rendered through omnis
+}
+
+// newJSONResponseInterceptor wraps the context's current writer
+func newJSONResponseInterceptor(c *gin.Context, config *JSONRendererConfig) *jsonResponseInterceptor {
+	return &jsonResponseInterceptor{
+		ResponseWriter: c.Writer,
+		context:        c,
+		config:         config,
+	}
 }
 
-// Write intercepts the response and processes JSON content
+// setResponseValue hands the unencoded response value to the interceptor, if installed,
+// so formats that need the typed value (JSON:API resources) can use it
+func setResponseValue(c *gin.Context, value interface{}) {
+	if c == nil {
+		return
+	}
+	if interceptor, ok := c.Writer.(*jsonResponseInterceptor); ok {
+		interceptor.value = value
+	}
+}
+
+// Write buffers JSON content until finish, and writes anything else through
 func (w *jsonResponseInterceptor) Write(data []byte) (int, error) {
-	if w.written {
+	if w.passthrough || w.finished {
 		return w.ResponseWriter.Write(data)
 	}
 
-	// Check if this is a JSON response
-	contentType := w.Header().Get("Content-Type")
-	if !strings.Contains(contentType, "application/json") {
-		return w.ResponseWriter.Write(data)
+	// Check if this is a response body the route has not opted out of
+	if w.body.Len() == 0 {
+		contentType := mediaType(w.Header().Get("Content-Type"))
+		if !w.buffers(contentType) || w.context.GetBool(SKIP_ENVELOPE) {
+			w.passthrough = true
+			return w.ResponseWriter.Write(data)
+		}
 	}
 
-	w.written = true
+	return w.body.Write(data)
+}
 
-	// Get logger from context if available (set by handlers using omnis.REQUEST_LOGGER)
-	var logger arbor.ILogger
-	if loggerInterface, exists := w.context.Get(REQUEST_LOGGER); exists {
-		if requestLogger, ok := loggerInterface.(arbor.ILogger); ok {
-			logger = requestLogger
-		}
+// WriteString buffers the string the same way as Write
+func (w *jsonResponseInterceptor) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeader captures the status code
+func (w *jsonResponseInterceptor) WriteHeader(statusCode int) {
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// WriteHeaderNow commits the headers, used by gin for responses without a body
+func (w *jsonResponseInterceptor) WriteHeaderNow() {
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Written reports whether a response has been written or buffered
+func (w *jsonResponseInterceptor) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Size returns the number of bytes written or buffered
+func (w *jsonResponseInterceptor) Size() int {
+	if w.body.Len() > 0 {
+		return w.body.Len()
 	}
+	return w.ResponseWriter.Size()
+}
+
+// Flush writes any buffered content unchanged and switches to streaming
+func (w *jsonResponseInterceptor) Flush() {
+	w.stream()
+	w.ResponseWriter.Flush()
+}
 
-	// Track if we're using request logger vs default logger
-	usingRequestLogger := logger != nil
+// Hijack hands the connection to the caller, writing any buffered content first
+func (w *jsonResponseInterceptor) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.stream()
+	return w.ResponseWriter.Hijack()
+}
+
+// CloseNotify implements the http.CloseNotifier interface
+func (w *jsonResponseInterceptor) CloseNotify() <-chan bool {
+	return w.ResponseWriter.CloseNotify()
+}
+
+// stream switches to passthrough, writing the buffered content unchanged
+// A streamed body cannot be wrapped, since part of it has already been sent
+func (w *jsonResponseInterceptor) stream() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
 
-	// Fall back to default logger if available (but mark as not using request logger)
-	if logger == nil && w.config != nil {
-		logger = w.config.DefaultLogger
-		// Keep usingRequestLogger as false since we're using default
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes()) //nolint: errcheck
+		w.body.Reset()
 	}
+}
+
+// finish wraps the buffered JSON body and writes it to the underlying writer
+func (w *jsonResponseInterceptor) finish() {
+	if w.finished {
+		return
+	}
+	w.finished = true
+
+	if w.passthrough || w.body.Len() == 0 {
+		return
+	}
+
+	output := w.envelope(w.body.Bytes())
+	w.body.Reset()
+
+	// Any Content-Length set by the handler describes the unwrapped body
+	if !w.ResponseWriter.Written() {
+		w.Header().Set("Content-Length", strconv.Itoa(len(output)))
+	}
+
+	w.ResponseWriter.Write(output) //nolint: errcheck
+}
 
+// envelopeProbe reads only the top-level error key of an error response body
+// Unknown keys are skipped by the decoder without being allocated
+type envelopeProbe struct {
+	Error json.RawMessage `json:"error"`
+}
+
+// envelope processes the complete body and returns the enhanced output
+// JSON bodies are spliced into the ApiResponse as a json.RawMessage rather than
+// decoded and re-encoded, so the handler's encoding is kept as-is
+// Other formats, or an Accept header asking for one, go through the negotiated encoder
+func (w *jsonResponseInterceptor) envelope(data []byte) []byte {
 	// Log the response only if logger is available
-	if logger != nil {
+	if logger := resolveLogger(w.context, w.config); logger != nil {
 		logger.Debug().
-			Int("status_code", w.context.Writer.Status()).
+			Int("status_code", w.Status()).
 			Str("response_size", fmt.Sprintf("%d bytes", len(data))).
 			Msg("JSON response intercepted")
 	}
 
-	// Parse the JSON to potentially enhance it
-	var jsonData interface{}
-	if err := json.Unmarshal(data, &jsonData); err != nil {
-		// If we can't parse it, just pass it through
-		return w.ResponseWriter.Write(data)
+	isError := w.Status() >= http.StatusBadRequest
+	format := w.responseFormat(isError)
+	bodyType := mediaType(w.Header().Get("Content-Type"))
+
+	if format != FORMAT_STANDARD && w.negotiates() {
+		// Select the envelope encoder from the Accept header
+		if !strings.Contains(w.Header().Get("Vary"), "Accept") {
+			w.Header().Add("Vary", "Accept")
+		}
+		accept := w.context.GetHeader("Accept")
+
+		// A body no encoder serves, such as protobuf, is written untouched when the client accepts it
+		if w.encoders().Lookup(bodyType) == nil && (strings.TrimSpace(accept) == "" || acceptsMediaType(accept, bodyType)) {
+			return data
+		}
+
+		encoder, ok := w.encoders().Negotiate(accept, bodyType)
+		if !ok {
+			if acceptsMediaType(accept, bodyType) {
+				return data // The client accepts the body as rendered, but no envelope encoder matches
+			}
+			if !w.config.NotAcceptableAsJSON {
+				return w.notAcceptable()
+			}
+			// Nothing acceptable can be rendered, JSON is sent rather than a 406
+			if encoder = w.encoders().Lookup(JSON_CONTENT_TYPE); encoder == nil {
+				encoder = JSONEncoder()
+			}
+		}
+
+		if bodyType != JSON_CONTENT_TYPE || !servesMediaType(encoder, JSON_CONTENT_TYPE) {
+			return w.transcode(encoder, data, bodyType, isError)
+		}
+	} else if bodyType != JSON_CONTENT_TYPE {
+		return data
+	}
+
+	// Validate the JSON, probing error responses for their error key
+	// If we can't parse it, just pass it through
+	body := bytes.TrimSpace(data)
+	var probe envelopeProbe
+	if isError && len(body) > 0 && body[0] == '{' {
+		if err := w.jsonEncoder().Unmarshal(body, &probe); err != nil {
+			return data
+		}
+	} else if !w.jsonEncoder().Valid(body) {
+		return data
 	}
 
-	// Check if this is already an APIResponse (to avoid double-wrapping)
-	if apiResp, ok := jsonData.(map[string]interface{}); ok {
-		if _, hasVersion := apiResp["version"]; hasVersion {
-			if _, hasName := apiResp["name"]; hasName {
-				if _, hasResult := apiResp["result"]; hasResult {
-					// Already wrapped, just pretty print if needed
-					var output []byte
-					var writeErr error
-					if w.config != nil && (w.config.EnablePrettyPrint || w.isDevelopmentMode()) {
-						output, writeErr = json.MarshalIndent(jsonData, "", "  ")
-					} else {
-						output, writeErr = json.Marshal(jsonData)
-					}
-					if writeErr != nil {
-						return w.ResponseWriter.Write(data)
-					}
-					return w.ResponseWriter.Write(output)
+	// Check if this is already an APIResponse rendered by omnis (to avoid double-wrapping)
+	if w.context.GetBool(ENVELOPE_RENDERED) {
+		if redactor := w.redactor(); redactor != nil {
+			redacted, err := redactor.applyEnvelope(body, w.jsonEncoder())
+			if err != nil {
+				return data
+			}
+			body = redacted
+		}
+
+		if format == FORMAT_PROBLEM || format == FORMAT_JSONAPI {
+			// The result is kept raw so the converted document stays lossless
+			var rendered struct {
+				ApiResponse
+				Result json.RawMessage `json:"result"`
+			}
+			if err := w.jsonEncoder().Unmarshal(body, &rendered); err == nil {
+				if output, err := w.render(format, &rendered.ApiResponse, rendered.Result); err == nil {
+					return output
 				}
 			}
 		}
+
+		// Already wrapped, just pretty print if needed
+		return w.format(body)
+	}
+
+	if format == FORMAT_STANDARD {
+		// Standard JSON format - return original data without ApiResponse wrapping
+		return w.format(body)
 	}
 
 	// Wrap the response in APIResponse format
-	apiResponse := ApiResponse{
-		Version: "1.0.0",
-		Build:   "",
-		Name:    "",
-		Status:  w.context.Writer.Status(),
-		Scope:   "",
-		Result:  jsonData,
+	apiResponse := w.newApiResponse(json.RawMessage(body))
+
+	// Check if this is an error response (an error status with a non-null "error" field)
+	if probe.Error != nil && string(probe.Error) != "null" {
+		// Move error to the error field and clear result
+		var errMsg string
+		if err := w.jsonEncoder().Unmarshal(probe.Error, &errMsg); err != nil {
+			errMsg = string(probe.Error)
+		}
+		apiResponse.Error = errMsg
+		apiResponse.Result = nil
 	}
 
-	// Add service config if available
-	if w.config != nil && w.config.ServiceConfig != nil {
-		apiResponse.Version = w.config.ServiceConfig.Version
-		apiResponse.Build = w.config.ServiceConfig.Build
-		apiResponse.Name = w.config.ServiceConfig.Name
-		apiResponse.Scope = w.config.ServiceConfig.Scope
-		// Support field can be set via configuration or left empty
+	result, _ := apiResponse.Result.(json.RawMessage)
+	output, err := w.render(format, &apiResponse, result)
+	if err != nil {
+		return data // Fall back to original
 	}
 
+	return output
+}
+
+// newApiResponse builds the envelope around a result with the service metadata,
+// correlation ID and the request logger's captured logs
+func (w *jsonResponseInterceptor) newApiResponse(result interface{}) ApiResponse {
+	var serviceConfig *ServiceConfig
+	if w.config != nil {
+		serviceConfig = w.config.ServiceConfig
+	}
+	apiResponse := newServiceResponse(serviceConfig, w.Status())
+	apiResponse.Result = result
+
 	// Get correlation ID from context
 	if correlationID, exists := w.context.Get(CORRELATION_ID_KEY); exists {
 		if id, ok := correlationID.(string); ok {
 			apiResponse.CorrelationId = id
 		}
 	}
+	apiResponse.ClientCorrelationId = GetClientCorrelationID(w.context)
+
+	// Use the configured log level, or the level an authorized request asked for
+	logLevel := captureLogLevel(w.context, w.config)
+
+	// Only the request logger carries this request's correlation ID
+	apiResponse.Log = requestLogs(w.context, resolveLogger(w.context, nil), apiResponse.CorrelationId, logLevel, w.config)
 
-	// Handle log entries based on request logger status
-	if !usingRequestLogger {
-		// No request logger was set
-		apiResponse.Log = map[string]interface{}{
-			"status": "no logs found - request logger not set",
+	apiResponse.Request = requestDetails(w.context, w.config)
+
+	w.redactor().apply(&apiResponse, w.jsonEncoder())
+
+	return apiResponse
+}
+
+// render encodes the envelope as JSON in the response format
+func (w *jsonResponseInterceptor) render(format string, response *ApiResponse, result json.RawMessage) ([]byte, error) {
+	switch format {
+	case FORMAT_PROBLEM:
+		return w.problem(response)
+	case FORMAT_JSONAPI:
+		return w.jsonApi(response, result)
+	}
+	return w.encode(response)
+}
+
+// transcode renders the envelope with a negotiated encoder, for non-JSON bodies or a non-JSON Accept
+// The problem and JSON:API formats are JSON documents, so other media types use the ApiResponse envelope
+func (w *jsonResponseInterceptor) transcode(encoder IEncoder, data []byte, bodyType string, isError bool) []byte {
+	var apiResponse ApiResponse
+	if bodyType == JSON_CONTENT_TYPE && w.context.GetBool(ENVELOPE_RENDERED) {
+		var rendered struct {
+			ApiResponse
+			Result json.RawMessage `json:"result"`
+		}
+		if err := w.jsonEncoder().Unmarshal(data, &rendered); err != nil {
+			return data
 		}
+		apiResponse = rendered.ApiResponse
+		apiResponse.Result = rendered.Result
+		w.redactor().apply(&apiResponse, w.jsonEncoder())
 	} else {
-		// Request logger is set - try to capture logs
-		correlationID, exists := w.context.Get(CORRELATION_ID_KEY)
-		if !exists {
-			apiResponse.Log = map[string]interface{}{
-				"status": "request logger set but no correlation ID in context",
-			}
-		} else if correlationIDStr, ok := correlationID.(string); !ok {
-			apiResponse.Log = map[string]interface{}{
-				"status": "request logger set but no correlation ID found",
-			}
-		} else if loggerInterface, exists := w.context.Get(REQUEST_LOGGER); !exists {
-			apiResponse.Log = map[string]interface{}{
-				"status": "request logger set but unable to access memory logs",
-			}
-		} else if requestLogger, ok := loggerInterface.(arbor.ILogger); !ok {
-			apiResponse.Log = map[string]interface{}{
-				"status": "request logger set but unable to access memory logs",
-			}
-		} else {
-			// Use configured log level or default to InfoLevel
-			logLevel := arbor.InfoLevel
-			if w.config != nil && w.config.ApiLogLevel != 0 {
-				logLevel = w.config.ApiLogLevel
-			}
-			if logs, err := requestLogger.GetMemoryLogs(correlationIDStr, logLevel); err != nil || len(logs) == 0 {
-				apiResponse.Log = map[string]interface{}{
-					"status": "request logger set but no logs captured for correlation ID",
-				}
-			} else {
-				// Successfully got logs
-				apiResponse.Log = map[string]interface{}{
-					"count":   len(logs),
-					"entries": logs,
-				}
+		result, err := decodeBody(bodyType, data)
+		if err != nil {
+			return data // Fall back to original
+		}
+		apiResponse = w.newApiResponse(result)
+
+		if isError {
+			if errMsg, ok := errorMember(result); ok {
+				apiResponse.Error = errMsg
+				apiResponse.Result = nil
 			}
 		}
 	}
 
-	// Check response format configuration
-	// First check if debug parameter is present in the request
-	useStandardFormat := w.config != nil && w.config.ResponseFormat == "standard"
+	var output []byte
+	var err error
+	if _, builtin := encoder.(jsonEncoder); builtin {
+		// The built-in JSON encoder uses the configured JSON library, as JSON bodies do
+		output, err = w.encode(&apiResponse)
+	} else if output, err = encoder.Marshal(&apiResponse); err == nil && servesMediaType(encoder, JSON_CONTENT_TYPE) {
+		output = w.format(output)
+	}
+	if err != nil {
+		return data // Fall back to original
+	}
 
-	// Check for debug parameter using different methods
-	debugParam := w.context.Query("debug")
-	hasDebugParam := debugParam != ""
-	if !hasDebugParam {
-		// Also check if parameter exists with empty value
-		if _, exists := w.context.GetQuery("debug"); exists {
-			hasDebugParam = true
-		}
+	w.Header().Set("Content-Type", encoder.ContentType())
+	return output
+}
+
+// notAcceptable replaces the response with a 406 envelope when no encoder matches the Accept header
+func (w *jsonResponseInterceptor) notAcceptable() []byte {
+	w.ResponseWriter.WriteHeader(http.StatusNotAcceptable)
+	w.Header().Set("Content-Type", JSONEncoder().ContentType())
+
+	apiResponse := w.newApiResponse(nil)
+	apiResponse.Error = fmt.Sprintf("not acceptable - supported media types: %s",
+		strings.Join(w.encoders().MediaTypes(), ", "))
+
+	output, err := w.render(w.responseFormat(true), &apiResponse, nil)
+	if err != nil {
+		return nil
 	}
+	return output
+}
 
-	if hasDebugParam {
-		// Debug parameter present - force debug-response format (detailed API response)
-		useStandardFormat = false
+// redactor returns the configured redactor, or nil
+func (w *jsonResponseInterceptor) redactor() *Redactor {
+	if w.config != nil {
+		return w.config.Redactor
 	}
+	return nil
+}
 
-	if useStandardFormat {
-		// Standard JSON format - return original data without ApiResponse wrapping
-		var output []byte
-		var writeErr error
+// negotiates reports whether the envelope media type is negotiated from the Accept header
+func (w *jsonResponseInterceptor) negotiates() bool {
+	return w.config != nil && w.config.NegotiateFormat
+}
+
+// buffers reports whether a body of the media type is buffered to be enveloped
+func (w *jsonResponseInterceptor) buffers(mediaType string) bool {
+	if w.negotiates() {
+		return canDecodeBody(mediaType)
+	}
+	return mediaType == JSON_CONTENT_TYPE
+}
+
+// encoders returns the configured encoder registry, or the default registry
+func (w *jsonResponseInterceptor) encoders() *EncoderRegistry {
+	if w.config != nil && w.config.Encoders != nil {
+		return w.config.Encoders
+	}
+	return defaultEncoders
+}
 
-		if w.config != nil && (w.config.EnablePrettyPrint || w.isDevelopmentMode()) {
-			output, writeErr = json.MarshalIndent(jsonData, "", "  ")
-		} else {
-			output, writeErr = json.Marshal(jsonData)
+// servesMediaType reports whether the encoder serves the media type
+func servesMediaType(encoder IEncoder, mediaType string) bool {
+	for _, candidate := range encoder.MediaTypes() {
+		if strings.EqualFold(candidate, mediaType) {
+			return true
 		}
+	}
+	return false
+}
 
-		if writeErr != nil {
-			return w.ResponseWriter.Write(data) // Fall back to original
+// errorMember returns the non-null top-level error member of a decoded error body
+func errorMember(result interface{}) (string, bool) {
+	var value interface{}
+	switch r := result.(type) {
+	case json.RawMessage:
+		var probe envelopeProbe
+		if len(r) == 0 || r[0] != '{' || json.Unmarshal(r, &probe) != nil ||
+			probe.Error == nil || string(probe.Error) == "null" {
+			return "", false
+		}
+		var errMsg string
+		if err := json.Unmarshal(probe.Error, &errMsg); err != nil {
+			errMsg = string(probe.Error)
 		}
+		return errMsg, true
+	case orderedMap:
+		for i := 0; i+1 < len(r); i += 2 {
+			if r[i] == "error" {
+				value = r[i+1]
+			}
+		}
+	case map[string]interface{}:
+		value = r["error"]
+	}
+
+	if value == nil {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// responseFormat returns the format for this response
+// Error responses use ResponseFormat, and success responses use SuccessFormat when it is "problem"
+func (w *jsonResponseInterceptor) responseFormat(isError bool) string {
+	if w.config == nil || w.debugRequested() {
+		// Debug parameter present - force debug-response format (detailed API response)
+		return FORMAT_APIRESPONSE
+	}
+
+	format := w.config.ResponseFormat
+	if format == FORMAT_PROBLEM && !isError {
+		format = w.config.SuccessFormat
+	}
+
+	if format == "" {
+		return FORMAT_APIRESPONSE
+	}
+	return format
+}
+
+// debugRequested checks if the debug parameter is present in the request, with or without a value,
+// and the request is allowed to use it - always in DEV scope, otherwise only when the debug policy authorizes it
+func (w *jsonResponseInterceptor) debugRequested() bool {
+	return debugRequested(w.context, w.config)
+}
 
-		return w.ResponseWriter.Write(output)
+// problem converts the response to RFC 9457 problem details
+func (w *jsonResponseInterceptor) problem(response *ApiResponse) ([]byte, error) {
+	output, err := newProblemDetails(response, w.devScope()).encode(w.jsonEncoder())
+	if err != nil {
+		return nil, err
 	}
+	output = w.format(output)
 
-	// ApiResponse format (default)
-	// Check if this is an error response (typically has "error" field)
-	if errResp, ok := jsonData.(map[string]interface{}); ok {
-		if errMsg, hasError := errResp["error"]; hasError {
-			// Move error to the error field and clear result
-			apiResponse.Error = fmt.Sprintf("%v", errMsg)
-			apiResponse.Result = nil
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE)
+	return output, nil
+}
+
+// jsonApi converts the response to a JSON:API document
+// result is the encoded result, used as the primary data unless the typed value maps to resources
+func (w *jsonResponseInterceptor) jsonApi(response *ApiResponse, result json.RawMessage) ([]byte, error) {
+	data := result
+	if response.Status < http.StatusBadRequest {
+		var err error
+		if data, err = jsonApiData(w.value, result, w.jsonEncoder()); err != nil {
+			return nil, err
 		}
+		// Resources mapped from the typed value have not been through the envelope's redaction
+		data = w.redactor().applyResult(data, w.jsonEncoder())
 	}
 
-	// Marshal the wrapped response
-	var output []byte
-	var writeErr error
+	self := ""
+	if w.context.Request != nil && w.context.Request.URL != nil {
+		self = w.context.Request.URL.RequestURI()
+	}
 
-	if w.config != nil && (w.config.EnablePrettyPrint || w.isDevelopmentMode()) {
-		output, writeErr = json.MarshalIndent(apiResponse, "", "  ")
-	} else {
-		output, writeErr = json.Marshal(apiResponse)
+	output, err := w.encode(newJsonApiDocument(response, data, self, w.devScope()))
+	if err != nil {
+		return nil, err
 	}
 
-	if writeErr != nil {
-		return w.ResponseWriter.Write(data) // Fall back to original
+	w.Header().Set("Content-Type", JSONAPI_CONTENT_TYPE)
+	return output, nil
+}
+
+// encode marshals the envelope without HTML escaping, so the spliced body keeps
+// exactly the escaping applied by the original encoder (c.JSON vs c.PureJSON)
+func (w *jsonResponseInterceptor) encode(v interface{}) ([]byte, error) {
+	return w.jsonEncoder().Marshal(v, w.prettyPrint())
+}
+
+// jsonEncoder returns the configured JSON library, or the encoding/json adapter
+func (w *jsonResponseInterceptor) jsonEncoder() IJSONEncoder {
+	if w.config != nil && w.config.JSONEncoder != nil {
+		return w.config.JSONEncoder
+	}
+	return stdJSON{}
+}
+
+// format returns the JSON body, indented when pretty printing is enabled
+func (w *jsonResponseInterceptor) format(body []byte) []byte {
+	if !w.prettyPrint() {
+		return body
+	}
+
+	var output bytes.Buffer
+	if err := json.Indent(&output, body, "", "  "); err != nil {
+		return body
 	}
+	return output.Bytes()
+}
 
-	return w.ResponseWriter.Write(output)
+// prettyPrint reports whether output should be indented
+func (w *jsonResponseInterceptor) prettyPrint() bool {
+	return w.config != nil && (w.config.EnablePrettyPrint || w.isDevelopmentMode())
 }
 
-// WriteHeader captures the status code
-func (w *jsonResponseInterceptor) WriteHeader(statusCode int) {
-	w.ResponseWriter.WriteHeader(statusCode)
+// devScope reports whether the service config sets a DEV scope, which exposes captured logs and stacks
+// in the problem and JSON:API formats
+func (w *jsonResponseInterceptor) devScope() bool {
+	return w.config != nil && hasDevScope(w.config.ServiceConfig)
 }
 
 // isDevelopmentMode checks if we're in development mode
 func (w *jsonResponseInterceptor) isDevelopmentMode() bool {
-	if w.config == nil || w.config.ServiceConfig == nil {
+	if w.config == nil {
 		return true // Default to development if no config
 	}
-	scope := w.config.ServiceConfig.Scope
-	return scope == "" || scope == "DEV" || scope == "DEVELOPMENT"
+	return isDevScope(w.config.ServiceConfig)
 }
 
 // JSONMiddlewareWithDefaults creates middleware with default configuration
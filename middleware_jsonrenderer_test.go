@@ -6,13 +6,24 @@
 package omnis
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
 )
 
 func TestJSONRenderer(t *testing.T) {
@@ -166,3 +177,798 @@ func TestJSONRendererWithoutMiddleware(t *testing.T) {
 		assert.NotEmpty(t, w.Body.String())
 	})
 }
+
+func TestJSONRendererBuffering(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := &ServiceConfig{
+		Name:    "test-service",
+		Version: "1.0.0",
+		Scope:   "PRD",
+	}
+
+	t.Run("Multi Chunk Body Wrapped Once", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/chunked", func(c *gin.Context) {
+			body := `{"message":"chunked","count":2}`
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Header("Content-Length", strconv.Itoa(len(body)))
+			c.Status(http.StatusOK)
+			c.Writer.Write([]byte(body[:10]))
+			c.Writer.WriteString(body[10:])
+		})
+
+		req, _ := http.NewRequest("GET", "/chunked", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, map[string]interface{}{"message": "chunked", "count": float64(2)}, response.Result)
+		assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+	})
+
+	t.Run("Non JSON Written Through", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/text", func(c *gin.Context) {
+			c.String(http.StatusOK, "plain text")
+		})
+
+		req, _ := http.NewRequest("GET", "/text", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "plain text", w.Body.String())
+	})
+
+	t.Run("Flush Streams Unwrapped", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/stream", func(c *gin.Context) {
+			c.Header("Content-Type", "application/json")
+			c.Writer.Write([]byte(`{"line":1}` + "\n"))
+			c.Writer.Flush()
+			c.Writer.Write([]byte(`{"line":2}` + "\n"))
+		})
+
+		req, _ := http.NewRequest("GET", "/stream", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, `{"line":1}`+"\n"+`{"line":2}`+"\n", w.Body.String())
+		assert.True(t, w.Flushed)
+	})
+
+	t.Run("No Content", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.DELETE("/item", func(c *gin.Context) {
+			c.JSON(http.StatusNoContent, nil)
+		})
+
+		req, _ := http.NewRequest("DELETE", "/item", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("Hijack Passes Connection", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/upgrade", func(c *gin.Context) {
+			conn, rw, err := c.Writer.Hijack()
+			require.NoError(t, err)
+			defer conn.Close()
+
+			rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+			rw.Flush()
+		})
+
+		server := httptest.NewServer(r)
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/upgrade")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hijacked", string(body))
+	})
+
+	t.Run("Panic Discards Buffer For Recovery", func(t *testing.T) {
+		r := gin.New()
+		r.Use(Recovery())
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/panic", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"partial": true})
+			panic("late failure")
+		})
+
+		req, _ := http.NewRequest("GET", "/panic", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.False(t, strings.Contains(w.Body.String(), "partial"))
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusText(http.StatusInternalServerError), response.Error)
+	})
+}
+
+// benchmarkPayload builds a representative list response encoded the way c.JSON would
+func benchmarkPayload(b *testing.B) []byte {
+	type address struct {
+		Street   string `json:"street"`
+		City     string `json:"city"`
+		Postcode string `json:"postcode"`
+	}
+	type user struct {
+		ID       int64    `json:"id"`
+		Name     string   `json:"name"`
+		Email    string   `json:"email"`
+		Active   bool     `json:"active"`
+		Roles    []string `json:"roles"`
+		Balance  float64  `json:"balance"`
+		Address  address  `json:"address"`
+		Metadata gin.H    `json:"metadata"`
+	}
+
+	users := make([]user, 50)
+	for i := range users {
+		users[i] = user{
+			ID:      int64(1000 + i),
+			Name:    "User " + strconv.Itoa(i),
+			Email:   "user" + strconv.Itoa(i) + "@example.com",
+			Active:  i%2 == 0,
+			Roles:   []string{"reader", "writer"},
+			Balance: float64(i) * 10.5,
+			Address: address{Street: "1 Example Street", City: "Sydney", Postcode: "2000"},
+			Metadata: gin.H{
+				"created": "2025-08-27T15:30:00Z",
+				"tags":    []string{"a", "b", "c"},
+			},
+		}
+	}
+
+	data, err := json.Marshal(gin.H{"users": users, "count": len(users)})
+	require.NoError(b, err)
+	return data
+}
+
+// legacyEnvelope reproduces the previous interceptor, which decoded the body into
+// interface{} and re-encoded it inside the ApiResponse
+func legacyEnvelope(w *jsonResponseInterceptor, data []byte) []byte {
+	var jsonData interface{}
+	if err := json.Unmarshal(data, &jsonData); err != nil {
+		return data
+	}
+
+	apiResponse := ApiResponse{
+		Version:       w.config.ServiceConfig.Version,
+		Name:          w.config.ServiceConfig.Name,
+		Scope:         w.config.ServiceConfig.Scope,
+		Status:        w.Status(),
+		CorrelationId: w.context.GetString(CORRELATION_ID_KEY),
+		Log:           memoryLogs(nil, "", arbor.InfoLevel, nil),
+		Result:        jsonData,
+	}
+
+	output, err := json.Marshal(apiResponse)
+	if err != nil {
+		return data
+	}
+	return output
+}
+
+func BenchmarkJSONEnvelope(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/users", nil)
+	c.Set(CORRELATION_ID_KEY, "benchmark")
+	c.Header("Content-Type", "application/json; charset=utf-8")
+
+	w := newJSONResponseInterceptor(c, &JSONRendererConfig{
+		ServiceConfig: &ServiceConfig{Name: "bench-service", Version: "1.0.0", Scope: "PRD"},
+	})
+	payload := benchmarkPayload(b)
+
+	b.Run("RoundTrip", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			legacyEnvelope(w, payload)
+		}
+	})
+
+	b.Run("Splice", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			w.envelope(payload)
+		}
+	})
+}
+
+func TestJSONRendererLossless(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := &JSONRendererConfig{ServiceConfig: &ServiceConfig{Name: "test-service", Version: "1.0.0", Scope: "PRD"}}
+
+	t.Run("Large Integers Keep Precision", func(t *testing.T) {
+		// 2^53 + 1 cannot be represented by float64
+		body := serveTestRequest(newTestRouter(nil, config, "/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"id": int64(9007199254740993), "ids": []int64{math.MaxInt64}})
+		}), "/test").Body.String()
+
+		assert.Contains(t, body, `"id":9007199254740993`)
+		assert.Contains(t, body, `"ids":[9223372036854775807]`)
+
+		decoder := json.NewDecoder(strings.NewReader(body))
+		decoder.UseNumber()
+		var response struct {
+			Result struct {
+				ID json.Number `json:"id"`
+			} `json:"result"`
+		}
+		require.NoError(t, decoder.Decode(&response))
+		assert.Equal(t, "9007199254740993", response.Result.ID.String())
+	})
+
+	t.Run("Struct Field Order Preserved", func(t *testing.T) {
+		type ordered struct {
+			Zeta  string `json:"zeta"`
+			Alpha string `json:"alpha"`
+			Mid   int    `json:"mid"`
+		}
+
+		body := serveTestRequest(newTestRouter(nil, config, "/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, ordered{Zeta: "z", Alpha: "a", Mid: 1})
+		}), "/test").Body.String()
+
+		assert.Contains(t, body, `"result":{"zeta":"z","alpha":"a","mid":1}`)
+	})
+
+	t.Run("HTML Escaping Of Original Encoder", func(t *testing.T) {
+		escaped := serveTestRequest(newTestRouter(nil, config, "/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"html": "<b>bold</b> & more"})
+		}), "/test").Body.String()
+		assert.Contains(t, escaped, `"html":"\u003cb\u003ebold\u003c/b\u003e \u0026 more"`)
+
+		pure := serveTestRequest(newTestRouter(nil, config, "/test", func(c *gin.Context) {
+			c.PureJSON(http.StatusOK, gin.H{"html": "<b>bold</b> & more"})
+		}), "/test").Body.String()
+		assert.Contains(t, pure, `"html":"<b>bold</b> & more"`)
+	})
+}
+
+func TestJSONRendererEnvelopeMarker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := &ServiceConfig{Name: "test-service", Version: "1.0.0", Scope: "PRD"}
+
+	t.Run("Domain Object With Envelope Keys Is Wrapped", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/release", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"version": "2.0", "name": "release", "result": "passed"})
+		})
+
+		response := decodeTestResponse[map[string]json.RawMessage](t, serveTestRequest(r, "/release"))
+		assert.JSONEq(t, `{"version":"2.0","name":"release","result":"passed"}`, string(response["result"]))
+		assert.JSONEq(t, `"test-service"`, string(response["name"]))
+	})
+
+	t.Run("Error Key On Success Is Business Data", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/validation", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"field": "email", "error": "already registered"})
+		})
+
+		response := decodeTestResponse[map[string]json.RawMessage](t, serveTestRequest(r, "/validation"))
+		assert.JSONEq(t, `{"field":"email","error":"already registered"}`, string(response["result"]))
+		assert.Nil(t, response["error"])
+	})
+
+	t.Run("Error Key On Error Status Is Moved", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/bad", func(c *gin.Context) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		})
+
+		w := serveTestRequest(r, "/bad")
+		response := decodeTestResponse[map[string]json.RawMessage](t, w)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `"invalid input"`, string(response["error"]))
+		assert.JSONEq(t, `null`, string(response["result"]))
+	})
+
+	t.Run("SkipEnvelope Route", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/raw", SkipEnvelope(), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"raw": true})
+		})
+
+		response := decodeTestResponse[map[string]json.RawMessage](t, serveTestRequest(r, "/raw"))
+		assert.JSONEq(t, `true`, string(response["raw"]))
+		assert.Nil(t, response["result"])
+	})
+}
+
+func TestJSONRendererProvisionLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	defaultLogger := arbor.Logger().WithMemoryWriter(models.WriterConfiguration{})
+
+	newRouter := func(provision bool) *gin.Engine {
+		r := newTestRouter(nil, &JSONRendererConfig{
+			ServiceConfig:   &ServiceConfig{Name: "test-service", Scope: "DEV"},
+			DefaultLogger:   defaultLogger,
+			ProvisionLogger: provision,
+		}, "/auto", func(c *gin.Context) {
+			if logger := GetRequestLogger(c); logger != nil {
+				logger.Info().Msg("handled without WithLogger")
+			}
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+		r.GET("/explicit", func(c *gin.Context) {
+			logger := defaultLogger.Copy().WithCorrelationId(GetCorrelationID(c)).WithPrefix("Explicit")
+			WithLogger(c, logger)
+			logger.Info().Msg("handled with WithLogger")
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+		return r
+	}
+
+	t.Run("Provisioned", func(t *testing.T) {
+		body := serveTestRequest(newRouter(true), "/auto", withHeader("X-Correlation-ID", "provision-auto")).Body.String()
+		assert.Contains(t, body, "handled without WithLogger")
+		assert.NotContains(t, body, "request logger not set")
+	})
+
+	t.Run("Handler Logger Wins", func(t *testing.T) {
+		body := serveTestRequest(newRouter(true), "/explicit", withHeader("X-Correlation-ID", "provision-explicit")).Body.String()
+		assert.Contains(t, body, "Explicit|handled with WithLogger")
+	})
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		body := serveTestRequest(newRouter(false), "/auto", withHeader("X-Correlation-ID", "provision-disabled")).Body.String()
+		assert.Contains(t, body, "no logs found - request logger not set")
+	})
+
+	t.Run("Default Logger Untouched", func(t *testing.T) {
+		serveTestRequest(newRouter(true), "/auto", withHeader("X-Correlation-ID", "provision-shared"))
+		logs, err := defaultLogger.GetMemoryLogs("provision-shared", arbor.InfoLevel)
+		require.NoError(t, err)
+		assert.Len(t, logs, 1)
+
+		// The default logger itself was not tagged with the request's correlation ID
+		defaultLogger.Info().Msg("outside any request")
+		logs, err = defaultLogger.GetMemoryLogs("provision-shared", arbor.InfoLevel)
+		require.NoError(t, err)
+		assert.Len(t, logs, 1)
+	})
+}
+
+func TestJSONRendererProblemFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(scope string, successFormat string) *gin.Engine {
+		r := newTestRouter(nil, &JSONRendererConfig{
+			ServiceConfig:  &ServiceConfig{Name: "test-service", Version: "1.0.0", Scope: scope},
+			ResponseFormat: FORMAT_PROBLEM,
+			SuccessFormat:  successFormat,
+		}, "/missing", func(c *gin.Context) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		})
+		r.GET("/ok", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user": "john"})
+		})
+		r.GET("/render", func(c *gin.Context) {
+			RenderService(c).AsError(http.StatusConflict, errors.New("duplicate user"))
+		})
+		r.GET("/html", func(c *gin.Context) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "<b>name</b> & email are required"})
+		})
+		return r
+	}
+
+	t.Run("Error As Problem Details", func(t *testing.T) {
+		w := serveTestRequest(newRouter("PRD", ""), "/missing", withHeader("X-Correlation-ID", "problem-test"))
+		problem := decodeTestResponse[map[string]interface{}](t, w)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, PROBLEM_CONTENT_TYPE, w.Result().Header.Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), `{"type":"about:blank","title":"Not Found","status":404`))
+		assert.Equal(t, "user not found", problem["detail"])
+		assert.Equal(t, "problem-test", problem["instance"])
+		assert.NotContains(t, problem, "log")
+	})
+
+	t.Run("Logs Extension In DEV", func(t *testing.T) {
+		problem := decodeTestResponse[map[string]interface{}](t, serveTestRequest(newRouter("DEV", ""), "/missing", withHeader("X-Correlation-ID", "problem-test")))
+
+		assert.Equal(t, float64(http.StatusNotFound), problem["status"])
+		assert.Contains(t, problem, "log")
+	})
+
+	t.Run("Encoded Without HTML Escaping", func(t *testing.T) {
+		w := serveTestRequest(newRouter("PRD", ""), "/html", withHeader("X-Correlation-ID", "problem-test"))
+
+		assert.Contains(t, w.Body.String(), `"detail":"<b>name</b> & email are required"`)
+	})
+
+	t.Run("Rendered Error Converted", func(t *testing.T) {
+		w := serveTestRequest(newRouter("PRD", ""), "/render", withHeader("X-Correlation-ID", "problem-test"))
+		problem := decodeTestResponse[map[string]interface{}](t, w)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, PROBLEM_CONTENT_TYPE, w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, "duplicate user", problem["detail"])
+		assert.Equal(t, "Conflict", problem["title"])
+	})
+
+	t.Run("Success Uses ApiResponse By Default", func(t *testing.T) {
+		w := serveTestRequest(newRouter("PRD", ""), "/ok", withHeader("X-Correlation-ID", "problem-test"))
+		response := decodeTestResponse[map[string]interface{}](t, w)
+
+		assert.Contains(t, w.Result().Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, map[string]interface{}{"user": "john"}, response["result"])
+	})
+
+	t.Run("Success Uses Configured Format", func(t *testing.T) {
+		response := decodeTestResponse[map[string]interface{}](t, serveTestRequest(newRouter("PRD", FORMAT_STANDARD), "/ok", withHeader("X-Correlation-ID", "problem-test")))
+
+		assert.Equal(t, map[string]interface{}{"user": "john"}, response)
+	})
+
+	t.Run("Recovery Renders Problem Details", func(t *testing.T) {
+		r := gin.New()
+		r.Use(RecoveryWithConfig(&JSONRendererConfig{
+			ServiceConfig:  &ServiceConfig{Name: "test-service", Scope: "PRD"},
+			ResponseFormat: FORMAT_PROBLEM,
+		}))
+		r.GET("/panic", func(c *gin.Context) {
+			panic("something went wrong")
+		})
+
+		w := serveTestRequest(r, "/panic", withHeader("X-Correlation-ID", "problem-test"))
+		problem := decodeTestResponse[map[string]interface{}](t, w)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, PROBLEM_CONTENT_TYPE, w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, http.StatusText(http.StatusInternalServerError), problem["detail"])
+		assert.NotContains(t, problem, "stack")
+	})
+}
+
+// testArticle is a JSON:API resource used by the jsonapi format tests
+type testArticle struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func (a testArticle) ResourceType() string { return "articles" }
+func (a testArticle) ResourceID() string   { return strconv.FormatInt(a.ID, 10) }
+
+func TestJSONRendererJsonApiFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := newTestRouter(nil, &JSONRendererConfig{
+		ServiceConfig:  &ServiceConfig{Name: "test-service", Version: "2.1.0", Scope: "PRD"},
+		ResponseFormat: FORMAT_JSONAPI,
+	}, "/articles/1", func(c *gin.Context) {
+		C(c).Success(testArticle{ID: 1, Title: "Hello", Body: "World"})
+	})
+	r.GET("/articles", func(c *gin.Context) {
+		RenderService(c).AsResult(http.StatusOK, []testArticle{{ID: 1, Title: "One"}, {ID: 2, Title: "Two"}})
+	})
+	r.GET("/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"count": 2})
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "article not found"})
+	})
+
+	t.Run("Single Resource", func(t *testing.T) {
+		w := serveTestRequest(r, "/articles/1", withHeader("X-Correlation-ID", "jsonapi-test"))
+		document := decodeTestResponse[JsonApiDocument](t, w)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, JSONAPI_CONTENT_TYPE, w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, `{"type":"articles","id":"1","attributes":{"title":"Hello","body":"World"}}`, string(document.Data))
+		assert.Equal(t, "jsonapi-test", document.Meta["correlationid"])
+		assert.Equal(t, "2.1.0", document.Meta["version"])
+		assert.NotContains(t, document.Meta, "log")
+		assert.Equal(t, "/articles/1", document.Links["self"])
+		assert.Empty(t, document.Errors)
+	})
+
+	t.Run("Resource Collection From RenderService", func(t *testing.T) {
+		document := decodeTestResponse[JsonApiDocument](t, serveTestRequest(r, "/articles", withHeader("X-Correlation-ID", "jsonapi-test")))
+
+		var resources []JsonApiResource
+		require.NoError(t, json.Unmarshal(document.Data, &resources))
+		require.Len(t, resources, 2)
+		assert.Equal(t, "articles", resources[1].Type)
+		assert.Equal(t, "2", resources[1].ID)
+		assert.JSONEq(t, `{"title":"Two","body":""}`, string(resources[1].Attributes))
+		assert.Equal(t, "jsonapi-test", document.Meta["correlationid"])
+	})
+
+	t.Run("Plain Body As Data", func(t *testing.T) {
+		document := decodeTestResponse[JsonApiDocument](t, serveTestRequest(r, "/stats", withHeader("X-Correlation-ID", "jsonapi-test")))
+
+		assert.JSONEq(t, `{"count":2}`, string(document.Data))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		w := serveTestRequest(r, "/missing", withHeader("X-Correlation-ID", "jsonapi-test"))
+		document := decodeTestResponse[JsonApiDocument](t, w)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Nil(t, document.Data)
+		require.Len(t, document.Errors, 1)
+		assert.Equal(t, "404", document.Errors[0].Status)
+		assert.Equal(t, "Not Found", document.Errors[0].Title)
+		assert.Equal(t, "article not found", document.Errors[0].Detail)
+		assert.Equal(t, "jsonapi-test", document.Errors[0].ID)
+	})
+
+	t.Run("Logs And Unescaped Attributes In DEV", func(t *testing.T) {
+		r := newTestRouter(nil, &JSONRendererConfig{
+			ServiceConfig:  &ServiceConfig{Name: "test-service", Version: "2.1.0", Scope: "DEV"},
+			ResponseFormat: FORMAT_JSONAPI,
+		}, "/articles/1", func(c *gin.Context) {
+			C(c).Success(testArticle{ID: 1, Title: "<b>Fish & Chips</b>"})
+		})
+
+		w := serveTestRequest(r, "/articles/1", withHeader("X-Correlation-ID", "jsonapi-test"))
+		document := decodeTestResponse[JsonApiDocument](t, w)
+
+		assert.Contains(t, document.Meta, "log")
+		assert.Contains(t, w.Body.String(), `"title": "<b>Fish & Chips</b>"`)
+	})
+}
+
+// testTextEncoder is a custom envelope encoder used by the content negotiation tests
+type testTextEncoder struct{}
+
+func (testTextEncoder) ContentType() string  { return "text/plain; charset=utf-8" }
+func (testTextEncoder) MediaTypes() []string { return []string{"text/plain"} }
+func (testTextEncoder) Marshal(v interface{}) ([]byte, error) {
+	response := v.(*ApiResponse)
+	return []byte(fmt.Sprintf("%d %s", response.Status, response.CorrelationId)), nil
+}
+
+func TestJSONRendererContentNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(config *JSONRendererConfig) *gin.Engine {
+		r := newTestRouter(nil, config, "/json", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"id": int64(math.MaxInt64), "name": "widget"})
+		})
+		r.GET("/xml", func(c *gin.Context) {
+			c.XML(http.StatusOK, gin.H{"name": "widget"})
+		})
+		r.GET("/yaml", func(c *gin.Context) {
+			c.YAML(http.StatusOK, gin.H{"name": "widget"})
+		})
+		r.GET("/markup", func(c *gin.Context) {
+			c.YAML(http.StatusOK, gin.H{"note": "<b>fish & chips</b>"})
+		})
+		r.GET("/protobuf", func(c *gin.Context) {
+			c.Data(http.StatusOK, PROTOBUF_CONTENT_TYPE, []byte{0x0a, 0x03, 'a', 'b', 'c'})
+		})
+		r.GET("/missing", func(c *gin.Context) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "widget not found"})
+		})
+		r.GET("/render", func(c *gin.Context) {
+			RenderService(c).AsResult(http.StatusOK, gin.H{"name": "widget"})
+		})
+		return r
+	}
+	prd := &JSONRendererConfig{
+		ServiceConfig:   &ServiceConfig{Name: "test-service", Version: "1.0.0", Scope: "PRD"},
+		NegotiateFormat: true,
+	}
+	correlationID := withHeader("X-Correlation-ID", "negotiation-test")
+
+	t.Run("Opt In", func(t *testing.T) {
+		config := *prd
+		config.NegotiateFormat = false
+
+		w := serveTestRequest(newRouter(&config), "/json", correlationID, withHeader("Accept", "application/xml"))
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Empty(t, w.Header().Get("Vary"))
+		assert.Contains(t, w.Body.String(), `"result":{"id":9223372036854775807,"name":"widget"}`)
+
+		w = serveTestRequest(newRouter(&config), "/xml", correlationID, withHeader("Accept", "application/json"))
+		assert.Equal(t, "application/xml; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, "<map><name>widget</name></map>", w.Body.String())
+	})
+
+	t.Run("JSON By Default", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/json", correlationID, withHeader("Accept", "*/*"))
+
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+		assert.Contains(t, w.Body.String(), `"result":{"id":9223372036854775807,"name":"widget"}`)
+	})
+
+	t.Run("Browsers Get The Body Format", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/json", correlationID, withHeader("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `"result":{"id":9223372036854775807,"name":"widget"}`)
+	})
+
+	t.Run("XML Envelope", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/json", correlationID, withHeader("Accept", "application/xml"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/xml; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		body := w.Body.String()
+		assert.True(t, strings.HasPrefix(body, "<response><version>1.0.0</version>"))
+		assert.Contains(t, body, "<correlationid>negotiation-test</correlationid>")
+		assert.Contains(t, body, "<result><id>9223372036854775807</id><name>widget</name></result>")
+	})
+
+	t.Run("YAML Envelope", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/json", correlationID, withHeader("Accept", "application/yaml"))
+
+		assert.Equal(t, "application/yaml; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		var response map[string]interface{}
+		require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "negotiation-test", response["correlationid"])
+		assert.Equal(t, map[string]interface{}{"id": math.MaxInt64, "name": "widget"}, response["result"])
+	})
+
+	t.Run("MessagePack And CBOR Envelopes", func(t *testing.T) {
+		for accept, handle := range map[string]codec.Handle{MSGPACK_CONTENT_TYPE: msgpackHandle, CBOR_CONTENT_TYPE: cborHandle} {
+			w := serveTestRequest(newRouter(prd), "/json", correlationID, withHeader("Accept", accept))
+
+			assert.Equal(t, accept, w.Result().Header.Get("Content-Type"))
+			var response map[string]interface{}
+			require.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), handle).Decode(&response), accept)
+			assert.Equal(t, "negotiation-test", response["correlationid"], accept)
+			result := response["result"].(map[string]interface{})
+			assert.EqualValues(t, int64(math.MaxInt64), result["id"], accept)
+		}
+	})
+
+	t.Run("XML And YAML Bodies Keep Their Format", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/xml", correlationID)
+		assert.Equal(t, "application/xml; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "<result><name>widget</name></result>")
+
+		w = serveTestRequest(newRouter(prd), "/yaml", correlationID)
+		assert.Equal(t, "application/yaml; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "correlationid: negotiation-test")
+		assert.Contains(t, w.Body.String(), "result:\n    name: widget")
+	})
+
+	t.Run("XML Body As JSON", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/xml", correlationID, withHeader("Accept", "application/json"))
+
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `"result":{"name":"widget"}`)
+	})
+
+	t.Run("Protobuf Body", func(t *testing.T) {
+		for _, accept := range []string{"", "*/*", PROTOBUF_CONTENT_TYPE} {
+			w := serveTestRequest(newRouter(prd), "/protobuf", correlationID, withHeader("Accept", accept))
+			assert.Equal(t, PROTOBUF_CONTENT_TYPE, w.Result().Header.Get("Content-Type"), accept)
+			assert.Equal(t, []byte{0x0a, 0x03, 'a', 'b', 'c'}, w.Body.Bytes(), accept)
+		}
+
+		// Enveloped only when the client asks for another format
+		w := serveTestRequest(newRouter(prd), "/protobuf", correlationID, withHeader("Accept", "application/json"))
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "negotiation-test", response["correlationid"])
+		assert.Equal(t, "CgNhYmM=", response["result"])
+	})
+
+	t.Run("Error Body", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/missing", correlationID, withHeader("Accept", "text/xml"))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "<error>widget not found</error>")
+		assert.Contains(t, w.Body.String(), "<result></result>")
+	})
+
+	t.Run("Rendered Envelope", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/render", correlationID, withHeader("Accept", "application/xml"))
+
+		body := w.Body.String()
+		assert.Equal(t, 1, strings.Count(body, "<correlationid>"))
+		assert.Contains(t, body, "<result><name>widget</name></result>")
+	})
+
+	t.Run("Not Acceptable", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/json", correlationID, withHeader("Accept", "text/html, image/png;q=0.9"))
+
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		response := decodeTestResponse[ApiResponse](t, w)
+		assert.Equal(t, http.StatusNotAcceptable, response.Status)
+		assert.Contains(t, response.Error, "application/xml")
+		assert.Nil(t, response.Result)
+	})
+
+	t.Run("Falls Back To JSON", func(t *testing.T) {
+		config := *prd
+		config.NotAcceptableAsJSON = true
+		w := serveTestRequest(newRouter(&config), "/xml", correlationID, withHeader("Accept", "text/html, image/png;q=0.9"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusOK, response.Status)
+		assert.Equal(t, map[string]interface{}{"name": "widget"}, response.Result)
+	})
+
+	t.Run("Problem Format Accepts Problem JSON", func(t *testing.T) {
+		config := *prd
+		config.ResponseFormat = FORMAT_PROBLEM
+		w := serveTestRequest(newRouter(&config), "/missing", correlationID, withHeader("Accept", PROBLEM_CONTENT_TYPE))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, PROBLEM_CONTENT_TYPE, w.Result().Header.Get("Content-Type"))
+	})
+
+	t.Run("Custom Encoder", func(t *testing.T) {
+		config := *prd
+		config.Encoders = NewEncoderRegistry(JSONEncoder(), testTextEncoder{})
+		w := serveTestRequest(newRouter(&config), "/json", correlationID, withHeader("Accept", "text/plain"))
+
+		assert.Equal(t, "text/plain; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, "200 negotiation-test", w.Body.String())
+
+		w = serveTestRequest(newRouter(&config), "/json", correlationID, withHeader("Accept", "application/xml"))
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	})
+
+	t.Run("Negotiated JSON Uses The JSON Library", func(t *testing.T) {
+		w := serveTestRequest(newRouter(prd), "/markup", correlationID, withHeader("Accept", "application/json"))
+
+		assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `"result":{"note":"<b>fish & chips</b>"}`)
+	})
+
+	t.Run("Standard Format Is Not Negotiated", func(t *testing.T) {
+		config := *prd
+		config.ResponseFormat = FORMAT_STANDARD
+		w := serveTestRequest(newRouter(&config), "/json", correlationID, withHeader("Accept", "application/xml"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"id":9223372036854775807,"name":"widget"}`, w.Body.String())
+	})
+}
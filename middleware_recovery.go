@@ -1,35 +1,116 @@
 package omnis
 
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
 // Recovery -> recovers from any panics and returns JSON error message with StatusInternalServerError(500)
-// func Recovery() gin.HandlerFunc {
+// Usage: router.Use(omnis.Recovery())
+func Recovery() gin.HandlerFunc {
+	return RecoveryWithConfig(nil)
+}
+
+// RecoveryWithConfig recovers from panics using the renderer configuration for the
+// service metadata and the fallback logger when no request logger is set
+// Usage: router.Use(omnis.RecoveryWithConfig(&omnis.JSONRendererConfig{...}))
+func RecoveryWithConfig(config *JSONRendererConfig) gin.HandlerFunc {
+
+	return func(ctx *gin.Context) {
+
+		defer func() {
+
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			logger := resolveLogger(ctx, config)
+
+			// The handler aborted deliberately - let net/http close the connection silently
+			if rec == http.ErrAbortHandler {
+				ctx.Abort()
+				panic(rec)
+			}
+
+			err, ok := rec.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rec)
+			}
 
-// 	return func(ctx *gin.Context) {
+			// The connection is dead, so no status or body can be written
+			if isBrokenPipe(err) {
+				if logger != nil {
+					logger.Warn().Err(err).Str("path", ctx.Request.URL.Path).Msg("Connection closed by client")
+				} else {
+					log := warnLogger()
+					log.Warn().Err(err).Str("path", ctx.Request.URL.Path).Msg("Connection closed by client")
+				}
+				ctx.Error(err) //nolint: errcheck
+				ctx.Abort()
+				return
+			}
 
-// 		defer func() {
+			if logger != nil {
+				logger.Error().Err(err).Str("path", ctx.Request.URL.Path).Msg("Panic recovered")
+			} else {
+				log := defaultLogger()
+				log.Error().Err(err).Str("path", ctx.Request.URL.Path).Msg("Panic recovered")
+			}
 
-// 			if err := recover(); err != nil {
+			if ctx.Writer.Written() {
+				ctx.Abort()
+				return
+			}
 
-// 				var (
-// 					render IRenderService = RenderService(ctx)
-// 					goerr  *errors.Error  = errors.Wrap(err, 3)
-// 					log    zerolog.Logger = defaultLogger().WithRequestContext(ctx).GetLogger().Level(zerolog.DebugLevel)
-// 				)
+			render := &renderservice{
+				ctx:    ctx,
+				logger: logger,
+			}
+			// Without its own config, recovery renders with the JSONMiddleware configuration, if any
+			renderer := config
+			if renderer == nil {
+				renderer = getRendererConfig(ctx)
+			}
+			if renderer != nil {
+				render.config = renderer.ServiceConfig
+				render.renderer = renderer
+			}
 
-// 				log.Err(goerr).Msg("")
+			// The panic value is only returned in DEV scope; elsewhere it stays in the logs
+			if !hasDevScope(render.config) {
+				err = errors.New(http.StatusText(http.StatusInternalServerError))
+			}
+			render.AsError(http.StatusInternalServerError, err)
 
-// 				fmt.Print(string(goerr.Stack()))
+			ctx.Abort()
 
-// 				render.AsError(http.StatusInternalServerError, err)
+		}()
 
-// 				ctx.Abort()
+		ctx.Next()
 
-// 				return
-// 			}
+	}
 
-// 		}()
+}
 
-// 		ctx.Next()
+// isBrokenPipe checks for a broken connection, which does not warrant a stack trace or response
+func isBrokenPipe(err error) bool {
+	var ne *net.OpError
+	if !errors.As(err, &ne) {
+		return false
+	}
 
-// 	}
+	var se *os.SyscallError
+	if !errors.As(ne, &se) {
+		return false
+	}
 
-// }
+	msg := strings.ToLower(se.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,126 @@
+// -----------------------------------------------------------------------
+// Recovery Middleware Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Panic Rendered as ApiResponse", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(RecoveryWithConfig(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "test-service", Version: "1.0.0", Scope: "DEV"},
+		}))
+
+		r.GET("/panic", func(c *gin.Context) {
+			panic("something went wrong")
+		})
+
+		req, _ := http.NewRequest("GET", "/panic", nil)
+		req.Header.Set("X-Correlation-ID", "recovery-test")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "something went wrong", response.Error)
+		assert.Equal(t, http.StatusInternalServerError, response.Status)
+		assert.Equal(t, "recovery-test", response.CorrelationId)
+		require.NotEmpty(t, response.Stack)
+		assert.Contains(t, strings.Join(response.Stack, "\n"), "TestRecovery")
+	})
+
+	t.Run("No Stack Outside DEV", func(t *testing.T) {
+		r := gin.New()
+		r.Use(RecoveryWithConfig(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "test-service", Scope: "PRD"},
+		}))
+
+		r.GET("/panic", func(c *gin.Context) {
+			panic("pq: password authentication failed")
+		})
+
+		req, _ := http.NewRequest("GET", "/panic", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusText(http.StatusInternalServerError), response.Error)
+		assert.Empty(t, response.Stack)
+		assert.NotContains(t, w.Body.String(), "password authentication")
+	})
+
+	t.Run("Panic Hidden Without A Scope", func(t *testing.T) {
+		r := gin.New()
+		r.Use(Recovery())
+
+		r.GET("/panic", func(c *gin.Context) {
+			panic("pq: password authentication failed")
+		})
+
+		req, _ := http.NewRequest("GET", "/panic", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.NotContains(t, w.Body.String(), "password authentication")
+	})
+
+	t.Run("Abort Handler Is Re-raised", func(t *testing.T) {
+		r := gin.New()
+		r.Use(Recovery())
+
+		r.GET("/abort", func(c *gin.Context) {
+			panic(http.ErrAbortHandler)
+		})
+
+		req, _ := http.NewRequest("GET", "/abort", nil)
+		w := httptest.NewRecorder()
+
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			r.ServeHTTP(w, req)
+		})
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("Broken Pipe Writes No Body", func(t *testing.T) {
+		r := gin.New()
+		r.Use(Recovery())
+
+		r.GET("/broken", func(c *gin.Context) {
+			panic(&net.OpError{
+				Op:  "write",
+				Net: "tcp",
+				Err: &os.SyscallError{Syscall: "write", Err: syscall.EPIPE},
+			})
+		})
+
+		req, _ := http.NewRequest("GET", "/broken", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Empty(t, w.Body.String())
+	})
+}
@@ -7,16 +7,37 @@ package omnis
 
 // ApiResponse represents the structured API response format (minimal version)
 type ApiResponse struct {
-	Version       string                 `json:"version,omitempty"`
-	Build         string                 `json:"build,omitempty"`
-	Name          string                 `json:"name,omitempty"`
-	Support       string                 `json:"support,omitempty"`
-	Status        int                    `json:"status"`
-	Scope         string                 `json:"scope,omitempty"`
-	CorrelationId string                 `json:"correlationid,omitempty"`
-	Log           map[string]interface{} `json:"log,omitempty"`
-	Result        interface{}            `json:"result"`
-	Error         string                 `json:"error,omitempty"`
-	Stack         []string               `json:"stack,omitempty"`
-	Request       map[string]interface{} `json:"request,omitempty"`
+	Version             string                 `json:"version,omitempty"`
+	Build               string                 `json:"build,omitempty"`
+	Name                string                 `json:"name,omitempty"`
+	Support             string                 `json:"support,omitempty"`
+	Status              int                    `json:"status"`
+	Scope               string                 `json:"scope,omitempty"`
+	CorrelationId       string                 `json:"correlationid,omitempty"`
+	ClientCorrelationId string                 `json:"client_correlation_id,omitempty"`
+	Log                 map[string]interface{} `json:"log,omitempty"`
+	Result              interface{}            `json:"result"`
+	Error               string                 `json:"error,omitempty"`
+	Stack               []string               `json:"stack,omitempty"`
+	Request             map[string]interface{} `json:"request,omitempty"`
+}
+
+// newServiceResponse creates an ApiResponse with the status and the service metadata
+// The version defaults to 1.0.0; the other fields are left empty without a service config
+func newServiceResponse(config *ServiceConfig, status int) ApiResponse {
+	response := ApiResponse{
+		Version: "1.0.0",
+		Status:  status,
+	}
+
+	if config != nil {
+		if config.Version != "" {
+			response.Version = config.Version
+		}
+		response.Build = config.Build
+		response.Name = config.Name
+		response.Scope = config.Scope
+	}
+
+	return response
 }
@@ -0,0 +1,207 @@
+// -----------------------------------------------------------------------
+// JSON:API Model
+// JSON:API document structure (https://jsonapi.org/format/)
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// ResourceIdentifier is implemented by values rendered as JSON:API resource objects
+// The remaining json fields of the value become the resource attributes
+type ResourceIdentifier interface {
+	ResourceType() string
+	ResourceID() string
+}
+
+// JsonApiDocument represents a JSON:API top-level document
+type JsonApiDocument struct {
+	Data   json.RawMessage        `json:"data,omitempty"`
+	Errors []JsonApiError         `json:"errors,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+	Links  map[string]string      `json:"links,omitempty"`
+}
+
+// JsonApiResource represents a JSON:API resource object
+type JsonApiResource struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id"`
+	Attributes json.RawMessage `json:"attributes,omitempty"`
+}
+
+// JsonApiError represents a JSON:API error object
+type JsonApiError struct {
+	ID     string                 `json:"id,omitempty"`
+	Status string                 `json:"status"`
+	Title  string                 `json:"title"`
+	Detail string                 `json:"detail,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// newJsonApiDocument converts an ApiResponse into a JSON:API document
+// data is the primary data for success responses; captured logs and the stack are only included in DEV scope
+func newJsonApiDocument(response *ApiResponse, data json.RawMessage, self string, dev bool) *JsonApiDocument {
+	document := &JsonApiDocument{
+		Meta: map[string]interface{}{
+			"version": response.Version,
+		},
+	}
+
+	if response.CorrelationId != "" {
+		document.Meta["correlationid"] = response.CorrelationId
+	}
+	if response.ClientCorrelationId != "" {
+		document.Meta["client_correlation_id"] = response.ClientCorrelationId
+	}
+	if dev && len(response.Log) > 0 {
+		document.Meta["log"] = response.Log
+	}
+	if self != "" {
+		document.Links = map[string]string{"self": self}
+	}
+
+	if response.Status < http.StatusBadRequest {
+		if len(data) == 0 {
+			data = json.RawMessage("null")
+		}
+		document.Data = data
+		return document
+	}
+
+	apiError := JsonApiError{
+		ID:     response.CorrelationId,
+		Status: strconv.Itoa(response.Status),
+		Title:  http.StatusText(response.Status),
+		Detail: response.Error,
+	}
+
+	meta := map[string]interface{}{}
+	if len(data) > 0 && string(data) != "null" {
+		meta["result"] = data
+	}
+	if dev && len(response.Stack) > 0 {
+		meta["stack"] = response.Stack
+	}
+	if len(meta) > 0 {
+		apiError.Meta = meta
+	}
+
+	document.Errors = []JsonApiError{apiError}
+	return document
+}
+
+// jsonApiData encodes the primary data with the JSON library, mapping ResourceIdentifier values
+// (or slices of them) to resource objects. Any other value is returned as its encoded body.
+func jsonApiData(value interface{}, body json.RawMessage, encoder IJSONEncoder) (json.RawMessage, error) {
+	if value == nil {
+		return body, nil
+	}
+
+	if resource, ok := value.(ResourceIdentifier); ok {
+		return encodeResources([]ResourceIdentifier{resource}, false, encoder)
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return body, nil
+	}
+
+	resources := make([]ResourceIdentifier, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		resource, ok := asResource(v.Index(i))
+		if !ok {
+			return body, nil
+		}
+		resources = append(resources, resource)
+	}
+
+	return encodeResources(resources, true, encoder)
+}
+
+// asResource returns the element as a ResourceIdentifier, including pointer receivers
+func asResource(v reflect.Value) (ResourceIdentifier, bool) {
+	if resource, ok := v.Interface().(ResourceIdentifier); ok {
+		return resource, true
+	}
+	if v.CanAddr() {
+		if resource, ok := v.Addr().Interface().(ResourceIdentifier); ok {
+			return resource, true
+		}
+	}
+	return nil, false
+}
+
+// encodeResources encodes resource objects, as an array when many is set
+func encodeResources(resources []ResourceIdentifier, many bool, encoder IJSONEncoder) (json.RawMessage, error) {
+	objects := make([]JsonApiResource, 0, len(resources))
+	for _, resource := range resources {
+		attributes, err := resourceAttributes(resource, encoder)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, JsonApiResource{
+			Type:       resource.ResourceType(),
+			ID:         resource.ResourceID(),
+			Attributes: attributes,
+		})
+	}
+
+	if many {
+		return encoder.Marshal(objects, false)
+	}
+	return encoder.Marshal(objects[0], false)
+}
+
+// resourceAttributes encodes the resource without its id and type members, keeping field order
+func resourceAttributes(resource ResourceIdentifier, encoder IJSONEncoder) (json.RawMessage, error) {
+	data, err := encoder.Marshal(resource, false)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("resource %s is not encoded as a JSON object", resource.ResourceType())
+	}
+
+	var attributes bytes.Buffer
+	attributes.WriteByte('{')
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		key, _ := token.(string)
+		if key == "id" || key == "type" {
+			continue
+		}
+
+		if attributes.Len() > 1 {
+			attributes.WriteByte(',')
+		}
+		name, _ := encoder.Marshal(key, false)
+		attributes.Write(name)
+		attributes.WriteByte(':')
+		attributes.Write(value)
+	}
+	attributes.WriteByte('}')
+
+	if attributes.Len() == 2 {
+		return nil, nil
+	}
+	return attributes.Bytes(), nil
+}
@@ -0,0 +1,20 @@
+// -----------------------------------------------------------------------
+// Log Entry Model
+// Structured form of a captured log entry in ApiResponse.Log
+// -----------------------------------------------------------------------
+
+package omnis
+
+import "time"
+
+// LogEntry is a captured log entry, emitted when JSONRendererConfig.LogFormat is "structured"
+// Fields and Caller are only set when the log source records them
+type LogEntry struct {
+	Index     string                 `json:"index"`
+	Level     string                 `json:"level"`
+	Timestamp time.Time              `json:"timestamp"`
+	Prefix    string                 `json:"prefix,omitempty"`
+	Message   string                 `json:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	Caller    string                 `json:"caller,omitempty"`
+}
@@ -0,0 +1,91 @@
+// -----------------------------------------------------------------------
+// Problem Details Model
+// RFC 9457 (formerly RFC 7807) error response structure
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"net/http"
+)
+
+// ProblemDetails represents an RFC 9457 problem details error response
+// Extensions are written as additional top-level members
+type ProblemDetails struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON writes the standard members followed by the extension members
+// Extensions never override the standard members
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	return p.encode(stdJSON{})
+}
+
+// encode writes the problem details with the JSON library, as MarshalJSON does
+func (p ProblemDetails) encode(encoder IJSONEncoder) ([]byte, error) {
+	// problem has the same fields without the MarshalJSON method
+	type problem ProblemDetails
+
+	data, err := encoder.Marshal(problem(p), false)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions := make(map[string]interface{}, len(p.Extensions))
+	for key, value := range p.Extensions {
+		switch key {
+		case "type", "title", "status", "detail", "instance":
+			continue
+		}
+		extensions[key] = value
+	}
+
+	if len(extensions) == 0 {
+		return data, nil
+	}
+
+	members, err := encoder.Marshal(extensions, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Splice {"type":...} and {"log":...} into {"type":...,"log":...}
+	output := append(data[:len(data)-1], ',')
+	return append(output, members[1:]...), nil
+}
+
+// newProblemDetails converts an ApiResponse into problem details
+// Captured logs and the stack are only included as extension members in DEV scope
+func newProblemDetails(response *ApiResponse, dev bool) *ProblemDetails {
+	problem := &ProblemDetails{
+		Type:       "about:blank",
+		Title:      http.StatusText(response.Status),
+		Status:     response.Status,
+		Detail:     response.Error,
+		Instance:   response.CorrelationId,
+		Extensions: map[string]interface{}{},
+	}
+
+	if response.Result != nil {
+		problem.Extensions["result"] = response.Result
+	}
+	if response.ClientCorrelationId != "" {
+		problem.Extensions["client_correlation_id"] = response.ClientCorrelationId
+	}
+
+	if dev {
+		if len(response.Log) > 0 {
+			problem.Extensions["log"] = response.Log
+		}
+		if len(response.Stack) > 0 {
+			problem.Extensions["stack"] = response.Stack
+		}
+	}
+
+	return problem
+}
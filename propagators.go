@@ -0,0 +1,291 @@
+// -----------------------------------------------------------------------
+// Propagators
+// Built-in X-Correlation-ID, W3C Trace Context, Zipkin B3 and Jaeger
+// propagators, composed in priority order for SetCorrelationID
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORRELATION_ID_HEADER is the header carrying the correlation ID between services
+const CORRELATION_ID_HEADER = "X-Correlation-ID"
+
+// Zipkin B3 single and multi-header formats
+const (
+	B3_HEADER                = "b3"
+	B3_TRACE_ID_HEADER       = "X-B3-TraceId"
+	B3_SPAN_ID_HEADER        = "X-B3-SpanId"
+	B3_PARENT_SPAN_ID_HEADER = "X-B3-ParentSpanId"
+	B3_SAMPLED_HEADER        = "X-B3-Sampled"
+	B3_FLAGS_HEADER          = "X-B3-Flags"
+)
+
+// JAEGER_HEADER is Jaeger's trace context header, "{trace-id}:{span-id}:{parent-span-id}:{flags}"
+const JAEGER_HEADER = "uber-trace-id"
+
+// PROPAGATOR_KEY is the key used to store the request's propagator in gin.Context
+const PROPAGATOR_KEY = "omnis_propagator"
+
+// DefaultPropagator reads X-Correlation-ID and W3C Trace Context, the formats SetCorrelationID uses
+func DefaultPropagator() IPropagator {
+	return CompositePropagator(CorrelationIDPropagator(), W3CPropagator())
+}
+
+// requestPropagator returns the propagator SetCorrelationID used for the request, or the default
+func requestPropagator(c *gin.Context) IPropagator {
+	if c != nil {
+		if propagator, ok := c.Value(PROPAGATOR_KEY).(IPropagator); ok {
+			return propagator
+		}
+	}
+	return DefaultPropagator()
+}
+
+// CompositePropagator combines propagators in priority order
+// The first propagator to extract a trace supplies it, and likewise for the correlation ID;
+// injection writes every propagator's headers
+func CompositePropagator(propagators ...IPropagator) IPropagator {
+	return compositePropagator(propagators)
+}
+
+type compositePropagator []IPropagator
+
+func (p compositePropagator) Extract(header http.Header) (PropagationContext, bool) {
+	var result PropagationContext
+	found := false
+	for _, propagator := range p {
+		if propagator == nil {
+			continue
+		}
+		propagation, ok := propagator.Extract(header)
+		if !ok {
+			continue
+		}
+		found = true
+		if result.CorrelationID == "" {
+			result.CorrelationID = propagation.CorrelationID
+		}
+		if result.Trace.TraceID == "" {
+			result.Trace = propagation.Trace
+		}
+	}
+	return result, found
+}
+
+func (p compositePropagator) Inject(propagation PropagationContext, header http.Header) {
+	for _, propagator := range p {
+		if propagator != nil {
+			propagator.Inject(propagation, header)
+		}
+	}
+}
+
+// CorrelationIDPropagator carries the correlation ID in X-Correlation-ID
+// The correlationid header is also read, for compatibility
+func CorrelationIDPropagator() IPropagator { return correlationIDPropagator{} }
+
+type correlationIDPropagator struct{}
+
+func (correlationIDPropagator) Extract(header http.Header) (PropagationContext, bool) {
+	correlationID := header.Get(CORRELATION_ID_HEADER)
+	if correlationID == "" {
+		correlationID = header.Get(CORRELATION_ID_KEY)
+	}
+	return PropagationContext{CorrelationID: correlationID}, correlationID != ""
+}
+
+func (correlationIDPropagator) Inject(propagation PropagationContext, header http.Header) {
+	if propagation.CorrelationID != "" {
+		header.Set(CORRELATION_ID_HEADER, propagation.CorrelationID)
+	}
+}
+
+// W3CPropagator carries the trace context in the W3C traceparent and tracestate headers
+func W3CPropagator() IPropagator { return w3cPropagator{} }
+
+type w3cPropagator struct{}
+
+func (w3cPropagator) Extract(header http.Header) (PropagationContext, bool) {
+	trace, ok := parseTraceparent(header.Get(TRACEPARENT_HEADER))
+	if !ok {
+		return PropagationContext{}, false
+	}
+	trace.State = validTracestate(header.Get(TRACESTATE_HEADER))
+	return PropagationContext{Trace: trace}, true
+}
+
+func (w3cPropagator) Inject(propagation PropagationContext, header http.Header) {
+	trace := propagation.Trace
+	if trace.TraceID == "" || trace.SpanID == "" {
+		return
+	}
+	header.Set(TRACEPARENT_HEADER, trace.Traceparent())
+	if trace.State != "" {
+		header.Set(TRACESTATE_HEADER, trace.State)
+	}
+}
+
+// B3Propagator carries the trace context in Zipkin's single b3 header
+// Both the single and multi-header formats are extracted, the single header first
+func B3Propagator() IPropagator { return b3Propagator{} }
+
+// B3MultiPropagator carries the trace context in Zipkin's X-B3-* headers
+// Both the single and multi-header formats are extracted, the single header first
+func B3MultiPropagator() IPropagator { return b3Propagator{multiHeader: true} }
+
+type b3Propagator struct {
+	multiHeader bool
+}
+
+func (b3Propagator) Extract(header http.Header) (PropagationContext, bool) {
+	if value := header.Get(B3_HEADER); value != "" {
+		trace, ok := parseB3(value)
+		return PropagationContext{Trace: trace}, ok
+	}
+
+	traceID := normalizeID(header.Get(B3_TRACE_ID_HEADER), 32)
+	spanID := normalizeID(header.Get(B3_SPAN_ID_HEADER), 16)
+	if traceID == "" || spanID == "" {
+		return PropagationContext{}, false
+	}
+
+	sampled := header.Get(B3_FLAGS_HEADER) == "1"
+	switch strings.ToLower(header.Get(B3_SAMPLED_HEADER)) {
+	case "1", "true":
+		sampled = true
+	}
+	return PropagationContext{Trace: TraceContext{TraceID: traceID, SpanID: spanID, Flags: traceFlags(sampled)}}, true
+}
+
+func (p b3Propagator) Inject(propagation PropagationContext, header http.Header) {
+	trace := propagation.Trace
+	if trace.TraceID == "" || trace.SpanID == "" {
+		return
+	}
+
+	sampled := "0"
+	if trace.Sampled() {
+		sampled = "1"
+	}
+
+	if !p.multiHeader {
+		value := trace.TraceID + "-" + trace.SpanID + "-" + sampled
+		if trace.ParentSpanID != "" {
+			value += "-" + trace.ParentSpanID
+		}
+		header.Set(B3_HEADER, value)
+		return
+	}
+
+	header.Set(B3_TRACE_ID_HEADER, trace.TraceID)
+	header.Set(B3_SPAN_ID_HEADER, trace.SpanID)
+	if trace.ParentSpanID != "" {
+		header.Set(B3_PARENT_SPAN_ID_HEADER, trace.ParentSpanID)
+	}
+	header.Set(B3_SAMPLED_HEADER, sampled)
+}
+
+// parseB3 parses a single b3 header, "{trace-id}-{span-id}[-{sampled}[-{parent-span-id}]]"
+// A header carrying only a sampling decision has no trace to continue
+func parseB3(value string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return TraceContext{}, false
+	}
+
+	traceID := normalizeID(parts[0], 32)
+	spanID := normalizeID(parts[1], 16)
+	if traceID == "" || spanID == "" {
+		return TraceContext{}, false
+	}
+
+	sampled := false
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1", "d":
+			sampled = true
+		case "0":
+		default:
+			return TraceContext{}, false
+		}
+	}
+	if len(parts) > 3 && normalizeID(parts[3], 16) == "" {
+		return TraceContext{}, false
+	}
+
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: traceFlags(sampled)}, true
+}
+
+// JaegerPropagator carries the trace context in Jaeger's uber-trace-id header
+func JaegerPropagator() IPropagator { return jaegerPropagator{} }
+
+type jaegerPropagator struct{}
+
+func (jaegerPropagator) Extract(header http.Header) (PropagationContext, bool) {
+	value := header.Get(JAEGER_HEADER)
+	if value == "" {
+		return PropagationContext{}, false
+	}
+	// Some clients URL-encode the separators
+	if unescaped, err := url.QueryUnescape(value); err == nil {
+		value = unescaped
+	}
+
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 4 {
+		return PropagationContext{}, false
+	}
+
+	traceID := normalizeID(parts[0], 32)
+	spanID := normalizeID(parts[1], 16)
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if traceID == "" || spanID == "" || err != nil {
+		return PropagationContext{}, false
+	}
+
+	return PropagationContext{Trace: TraceContext{TraceID: traceID, SpanID: spanID, Flags: traceFlags(flags&0x01 == 1)}}, true
+}
+
+func (jaegerPropagator) Inject(propagation PropagationContext, header http.Header) {
+	trace := propagation.Trace
+	if trace.TraceID == "" || trace.SpanID == "" {
+		return
+	}
+
+	parentSpanID := trace.ParentSpanID
+	if parentSpanID == "" {
+		parentSpanID = "0"
+	}
+	flags := "0"
+	if trace.Sampled() {
+		flags = "1"
+	}
+	header.Set(JAEGER_HEADER, trace.TraceID+":"+trace.SpanID+":"+parentSpanID+":"+flags)
+}
+
+// normalizeID validates a hex trace or span ID of up to size characters, returning it lowercased and
+// left-padded with zeros to size, as 64-bit B3 and Jaeger trace IDs are in W3C Trace Context
+// Returns "" for invalid or all-zero IDs
+func normalizeID(value string, size int) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || len(value) > size || !isLowerHex(value) || strings.Trim(value, "0") == "" {
+		return ""
+	}
+	return strings.Repeat("0", size-len(value)) + value
+}
+
+// traceFlags returns the W3C trace flags for a sampling decision
+func traceFlags(sampled bool) string {
+	if sampled {
+		return "01"
+	}
+	return "00"
+}
@@ -0,0 +1,228 @@
+// -----------------------------------------------------------------------
+// Propagator Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropagators(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const shortTraceID = "a3ce929d0e0e4736"
+	const spanID = "00f067aa0ba902b7"
+	const parentID = "b7ad6b7169203331"
+
+	headers := func(pairs ...string) http.Header {
+		header := http.Header{}
+		for i := 0; i < len(pairs); i += 2 {
+			header.Set(pairs[i], pairs[i+1])
+		}
+		return header
+	}
+
+	outgoing := PropagationContext{
+		CorrelationID: "order-123",
+		Trace:         TraceContext{TraceID: traceID, SpanID: spanID, ParentSpanID: parentID, Flags: "01", State: "rojo=1"},
+	}
+
+	t.Run("Correlation ID", func(t *testing.T) {
+		propagation, ok := CorrelationIDPropagator().Extract(headers("X-Correlation-ID", "order-123"))
+		require.True(t, ok)
+		assert.Equal(t, PropagationContext{CorrelationID: "order-123"}, propagation)
+
+		propagation, ok = CorrelationIDPropagator().Extract(headers("correlationid", "legacy-123"))
+		require.True(t, ok)
+		assert.Equal(t, "legacy-123", propagation.CorrelationID)
+
+		_, ok = CorrelationIDPropagator().Extract(http.Header{})
+		assert.False(t, ok)
+
+		header := http.Header{}
+		CorrelationIDPropagator().Inject(outgoing, header)
+		assert.Equal(t, headers("X-Correlation-ID", "order-123"), header)
+	})
+
+	t.Run("W3C", func(t *testing.T) {
+		propagation, ok := W3CPropagator().Extract(headers("traceparent", "00-"+traceID+"-"+spanID+"-01", "tracestate", "rojo=1"))
+		require.True(t, ok)
+		assert.Equal(t, TraceContext{TraceID: traceID, SpanID: spanID, Flags: "01", State: "rojo=1"}, propagation.Trace)
+
+		_, ok = W3CPropagator().Extract(headers("traceparent", "invalid"))
+		assert.False(t, ok)
+
+		header := http.Header{}
+		W3CPropagator().Inject(outgoing, header)
+		assert.Equal(t, headers("traceparent", "00-"+traceID+"-"+spanID+"-01", "tracestate", "rojo=1"), header)
+	})
+
+	t.Run("B3 Single Header", func(t *testing.T) {
+		valid := map[string]TraceContext{
+			traceID + "-" + spanID + "-1-" + parentID: {TraceID: traceID, SpanID: spanID, Flags: "01"},
+			traceID + "-" + spanID + "-d":             {TraceID: traceID, SpanID: spanID, Flags: "01"},
+			traceID + "-" + spanID + "-0":             {TraceID: traceID, SpanID: spanID, Flags: "00"},
+			shortTraceID + "-" + spanID:               {TraceID: "0000000000000000" + shortTraceID, SpanID: spanID, Flags: "00"},
+		}
+		for value, expected := range valid {
+			propagation, ok := B3Propagator().Extract(headers("b3", value))
+			require.True(t, ok, value)
+			assert.Equal(t, expected, propagation.Trace, value)
+		}
+
+		invalid := []string{
+			"1",
+			"0",
+			traceID,
+			traceID + "-" + spanID + "-x",
+			traceID + "-" + spanID + "-1-" + parentID + "-extra",
+			traceID + "-0000000000000000-1",
+			traceID + "0-" + spanID,
+		}
+		for _, value := range invalid {
+			_, ok := B3Propagator().Extract(headers("b3", value))
+			assert.False(t, ok, value)
+		}
+
+		header := http.Header{}
+		B3Propagator().Inject(outgoing, header)
+		assert.Equal(t, headers("b3", traceID+"-"+spanID+"-1-"+parentID), header)
+	})
+
+	t.Run("B3 Multi Header", func(t *testing.T) {
+		propagation, ok := B3Propagator().Extract(headers(
+			"X-B3-TraceId", shortTraceID,
+			"X-B3-SpanId", spanID,
+			"X-B3-ParentSpanId", parentID,
+			"X-B3-Sampled", "1",
+		))
+		require.True(t, ok)
+		assert.Equal(t, TraceContext{TraceID: "0000000000000000" + shortTraceID, SpanID: spanID, Flags: "01"}, propagation.Trace)
+
+		// The debug flag implies sampling
+		propagation, ok = B3MultiPropagator().Extract(headers("X-B3-TraceId", traceID, "X-B3-SpanId", spanID, "X-B3-Flags", "1"))
+		require.True(t, ok)
+		assert.True(t, propagation.Trace.Sampled())
+
+		_, ok = B3MultiPropagator().Extract(headers("X-B3-TraceId", traceID))
+		assert.False(t, ok)
+
+		header := http.Header{}
+		B3MultiPropagator().Inject(outgoing, header)
+		assert.Equal(t, headers(
+			"X-B3-TraceId", traceID,
+			"X-B3-SpanId", spanID,
+			"X-B3-ParentSpanId", parentID,
+			"X-B3-Sampled", "1",
+		), header)
+	})
+
+	t.Run("Jaeger", func(t *testing.T) {
+		valid := map[string]TraceContext{
+			traceID + ":" + spanID + ":0:1":                     {TraceID: traceID, SpanID: spanID, Flags: "01"},
+			shortTraceID + ":" + spanID + ":" + parentID + ":3": {TraceID: "0000000000000000" + shortTraceID, SpanID: spanID, Flags: "01"},
+			"abc%3A" + spanID + "%3A0%3A0":                      {TraceID: "00000000000000000000000000000abc", SpanID: spanID, Flags: "00"},
+		}
+		for value, expected := range valid {
+			propagation, ok := JaegerPropagator().Extract(headers("uber-trace-id", value))
+			require.True(t, ok, value)
+			assert.Equal(t, expected, propagation.Trace, value)
+		}
+
+		invalid := []string{
+			traceID + ":" + spanID + ":0",
+			traceID + ":" + spanID + ":0:zz",
+			"0:" + spanID + ":0:1",
+		}
+		for _, value := range invalid {
+			_, ok := JaegerPropagator().Extract(headers("uber-trace-id", value))
+			assert.False(t, ok, value)
+		}
+
+		header := http.Header{}
+		JaegerPropagator().Inject(outgoing, header)
+		assert.Equal(t, headers("uber-trace-id", traceID+":"+spanID+":"+parentID+":1"), header)
+	})
+
+	t.Run("Composite Priority", func(t *testing.T) {
+		propagator := CompositePropagator(W3CPropagator(), B3Propagator(), JaegerPropagator(), CorrelationIDPropagator())
+
+		// The first propagator to find a trace supplies it
+		propagation, ok := propagator.Extract(headers(
+			"b3", shortTraceID+"-"+spanID+"-1",
+			"uber-trace-id", traceID+":"+parentID+":0:0",
+			"X-Correlation-ID", "order-123",
+		))
+		require.True(t, ok)
+		assert.Equal(t, "0000000000000000"+shortTraceID, propagation.Trace.TraceID)
+		assert.Equal(t, "order-123", propagation.CorrelationID)
+
+		_, ok = propagator.Extract(http.Header{})
+		assert.False(t, ok)
+
+		header := http.Header{}
+		propagator.Inject(outgoing, header)
+		assert.Len(t, header, 5)
+		for _, key := range []string{"traceparent", "tracestate", "b3", "uber-trace-id", "X-Correlation-ID"} {
+			assert.NotEmpty(t, header.Get(key), key)
+		}
+	})
+}
+
+func TestSetCorrelationIDWithPropagator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+
+	var seen struct {
+		correlationID, traceID, spanID, parentSpanID string
+		downstream                                   http.Header
+	}
+
+	r := gin.New()
+	r.Use(SetCorrelationIDWithPropagator(CompositePropagator(B3MultiPropagator(), JaegerPropagator())))
+	r.GET("/hop", func(c *gin.Context) {
+		seen.correlationID = GetCorrelationID(c)
+		seen.traceID = GetTraceID(c)
+		seen.spanID = GetSpanID(c)
+		seen.parentSpanID = GetParentSpanID(c)
+		seen.downstream = http.Header{}
+		InjectTraceContext(c, seen.downstream)
+		c.String(http.StatusOK, "ok")
+	})
+
+	t.Run("Continues A Jaeger Trace", func(t *testing.T) {
+		w := serveTestRequest(r, "/hop", withHeader("uber-trace-id", traceID+":"+parentID+":0:1"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, traceID, seen.traceID)
+		assert.Equal(t, parentID, seen.parentSpanID)
+		assert.Equal(t, traceID, seen.correlationID)
+		assert.Equal(t, traceID, w.Header().Get("X-Correlation-ID"))
+
+		// Responses and downstream requests carry every configured format, and no others
+		assert.Equal(t, traceID+":"+seen.spanID+":"+parentID+":1", w.Header().Get("uber-trace-id"))
+		assert.Equal(t, seen.spanID, w.Header().Get("X-B3-SpanId"))
+		assert.Empty(t, w.Header().Get("traceparent"))
+		assert.Equal(t, seen.spanID, seen.downstream.Get("X-B3-SpanId"))
+		assert.Equal(t, parentID, seen.downstream.Get("X-B3-ParentSpanId"))
+		assert.Equal(t, "1", seen.downstream.Get("X-B3-Sampled"))
+	})
+
+	t.Run("Ignores Unconfigured Formats", func(t *testing.T) {
+		serveTestRequest(r, "/hop",
+			withHeader("traceparent", "00-"+traceID+"-"+parentID+"-01"),
+			withHeader("X-Correlation-ID", "order-123"))
+
+		assert.NotEqual(t, traceID, seen.traceID)
+		assert.Empty(t, seen.parentSpanID)
+		assert.Len(t, seen.correlationID, 36)
+		assert.NotEqual(t, "order-123", seen.correlationID)
+	})
+}
@@ -0,0 +1,372 @@
+// -----------------------------------------------------------------------
+// Redaction
+// Masks sensitive values in captured logs, request details and results
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DEFAULT_REDACTION_MASK replaces redacted values when RedactionConfig.Mask is not set
+const DEFAULT_REDACTION_MASK = "[REDACTED]"
+
+// RedactionConfig configures a Redactor
+// Paths are dotted JSON paths from the envelope, starting at log, request or result,
+// with * matching any key or array index, e.g. "request.headers.authorization" or "result.users[*].ssn"
+// Key patterns are case-insensitive regular expressions found anywhere in object keys, so "password"
+// also masks "user_password"; anchor a pattern with ^ and $ to match whole keys only. They are matched
+// against key=value or "key": value pairs inside strings such as log messages too
+type RedactionConfig struct {
+	Paths         []string   // JSON paths whose values are masked
+	KeyPatterns   []string   // Object keys whose values are masked, e.g. "password", "^(access|refresh)_?token$"
+	ValuePatterns []string   // Regular expressions masked within string values
+	Detectors     []Detector // Detectors masked within string values, e.g. DefaultDetectors()
+	RedactResult  bool       // Also redact the result (default: only the log and request sections)
+	Mask          string     // Replacement for masked values (default: "[REDACTED]")
+}
+
+// Detector finds sensitive substrings in string values
+type Detector struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool // Optional check on each match, e.g. the Luhn checksum of card numbers
+}
+
+// JWTDetector matches JSON Web Tokens
+func JWTDetector() Detector {
+	return Detector{
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	}
+}
+
+// PANDetector matches payment card numbers of 13 to 19 digits, optionally grouped by spaces or
+// dashes, that pass the Luhn checksum
+func PANDetector() Detector {
+	return Detector{
+		Name:     "pan",
+		Pattern:  regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Validate: luhnValid,
+	}
+}
+
+// EmailDetector matches email addresses
+func EmailDetector() Detector {
+	return Detector{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+}
+
+// DefaultDetectors returns the built-in JWT, card number and email detectors
+func DefaultDetectors() []Detector {
+	return []Detector{JWTDetector(), PANDetector(), EmailDetector()}
+}
+
+// luhnValid checks the Luhn checksum of the digits in a card number
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// keyValuePattern finds key=value and "key": value pairs inside strings
+// An unquoted value ends at whitespace, so only the first word of password=my secret is masked;
+// values containing spaces are only masked whole when quoted with " or '
+var keyValuePattern = regexp.MustCompile(`([A-Za-z0-9_.-]+)("?\s*[:=]\s*)("[^"]*"|'[^']*'|[^\s,;&"']+)`)
+
+// Redactor masks sensitive values in ApiResponse envelopes
+type Redactor struct {
+	paths        [][]string
+	keys         []*regexp.Regexp
+	detectors    []Detector
+	redactResult bool
+	mask         string
+}
+
+// NewRedactor compiles the redaction configuration
+// Usage: redactor, err := omnis.NewRedactor(omnis.RedactionConfig{KeyPatterns: []string{"password"}, Detectors: omnis.DefaultDetectors()})
+func NewRedactor(config RedactionConfig) (*Redactor, error) {
+	redactor := &Redactor{
+		detectors:    append([]Detector{}, config.Detectors...),
+		redactResult: config.RedactResult,
+		mask:         config.Mask,
+	}
+	if redactor.mask == "" {
+		redactor.mask = DEFAULT_REDACTION_MASK
+	}
+
+	for _, path := range config.Paths {
+		redactor.paths = append(redactor.paths, splitPath(path))
+	}
+
+	for _, pattern := range config.KeyPatterns {
+		key, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+		redactor.keys = append(redactor.keys, key)
+	}
+
+	for _, pattern := range config.ValuePatterns {
+		value, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value pattern %q: %w", pattern, err)
+		}
+		redactor.detectors = append(redactor.detectors, Detector{Name: "pattern", Pattern: value})
+	}
+
+	return redactor, nil
+}
+
+// splitPath splits a JSON path into segments, accepting a leading "$." and [n] or [*] indexes
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	return strings.Split(path, ".")
+}
+
+// Apply redacts the log and request sections of the response, and the result when configured
+// A redacted encoded result is re-encoded with StdJSON; use ApplyWithEncoder to match a configured JSONEncoder
+func (r *Redactor) Apply(response *ApiResponse) {
+	r.apply(response, StdJSON())
+}
+
+// ApplyWithEncoder redacts the response as Apply does, re-encoding a redacted encoded result with the encoder,
+// as JSONMiddleware does with JSONRendererConfig.JSONEncoder. A nil encoder uses StdJSON
+func (r *Redactor) ApplyWithEncoder(response *ApiResponse, encoder IJSONEncoder) {
+	if encoder == nil {
+		encoder = StdJSON()
+	}
+	r.apply(response, encoder)
+}
+
+// apply redacts the response as Apply does, re-encoding an encoded result with the JSON encoder
+func (r *Redactor) apply(response *ApiResponse, encoder IJSONEncoder) {
+	if r == nil || response == nil {
+		return
+	}
+
+	if response.Log != nil {
+		response.Log, _ = r.redact(response.Log, []string{"log"}).(map[string]interface{})
+	}
+	if response.Request != nil {
+		response.Request, _ = r.redact(response.Request, []string{"request"}).(map[string]interface{})
+	}
+	if r.redactResult && response.Result != nil {
+		response.Result = r.redactValue(response.Result, []string{"result"}, encoder)
+	}
+}
+
+// applyEnvelope redacts an encoded envelope, keeping any fields it has beyond ApiResponse,
+// and re-encodes it with the JSON encoder
+func (r *Redactor) applyEnvelope(body []byte, encoder IJSONEncoder) ([]byte, error) {
+	value, err := decodeOrdered(body)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, ok := value.(orderedMap)
+	if !ok {
+		return body, nil
+	}
+
+	for i := 0; i+1 < len(envelope); i += 2 {
+		switch key := envelope[i]; key {
+		case "log", "request":
+			envelope[i+1] = r.redact(envelope[i+1], []string{key.(string)})
+		case "result":
+			if r.redactResult {
+				envelope[i+1] = r.redact(envelope[i+1], []string{"result"})
+			}
+		}
+	}
+
+	return encoder.Marshal(envelope, false)
+}
+
+// applyResult redacts an encoded result when result redaction is configured
+func (r *Redactor) applyResult(result json.RawMessage, encoder IJSONEncoder) json.RawMessage {
+	if r == nil || !r.redactResult || len(result) == 0 {
+		return result
+	}
+	if redacted, ok := r.redactValue(result, []string{"result"}, encoder).(json.RawMessage); ok {
+		return redacted
+	}
+	return result
+}
+
+// redactValue redacts a result of any type via its JSON form
+// Encoded results stay encoded, re-encoded with the JSON encoder, so spliced bodies remain json.RawMessage
+func (r *Redactor) redactValue(value interface{}, path []string, encoder IJSONEncoder) interface{} {
+	var ordered interface{}
+	var err error
+	if raw, ok := value.(json.RawMessage); ok {
+		ordered, err = decodeOrdered(raw)
+	} else {
+		ordered, err = orderedValue(value)
+	}
+	if err != nil {
+		return r.mask // Unreadable results are masked rather than leaked
+	}
+
+	redacted := r.redact(ordered, path)
+	if _, ok := value.(json.RawMessage); ok {
+		data, err := encoder.Marshal(redacted, false)
+		if err != nil {
+			return r.mask
+		}
+		return json.RawMessage(data)
+	}
+	return redacted
+}
+
+// redact walks a decoded value, masking matched paths, keys and string contents
+func (r *Redactor) redact(value interface{}, path []string) interface{} {
+	if r.matchPath(path) {
+		return r.mask
+	}
+
+	switch v := value.(type) {
+	case orderedMap:
+		redacted := make(orderedMap, len(v))
+		for i := 0; i+1 < len(v); i += 2 {
+			key := fmt.Sprint(v[i])
+			redacted[i] = v[i]
+			redacted[i+1] = r.member(key, v[i+1], path)
+		}
+		return redacted
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = r.member(key, item, path)
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for key, item := range v {
+			redacted[key], _ = r.member(key, item, path).(string)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.redact(item, appendPath(path, strconv.Itoa(i)))
+		}
+		return redacted
+	case []LogEntry:
+		redacted := make([]LogEntry, len(v))
+		for i, entry := range v {
+			entryPath := appendPath(path, strconv.Itoa(i))
+			redacted[i] = entry
+			redacted[i].Message, _ = r.member("message", entry.Message, entryPath).(string)
+			if entry.Fields != nil {
+				redacted[i].Fields, _ = r.member("fields", entry.Fields, entryPath).(map[string]interface{})
+			}
+		}
+		return redacted
+	case []string:
+		redacted := make([]string, len(v))
+		for i, item := range v {
+			redacted[i], _ = r.redact(item, appendPath(path, strconv.Itoa(i))).(string)
+		}
+		return redacted
+	case string:
+		return r.redactString(v)
+	}
+
+	return value
+}
+
+// member redacts an object member, masking the whole value when the key matches
+func (r *Redactor) member(key string, value interface{}, path []string) interface{} {
+	if r.matchKey(key) {
+		return r.mask
+	}
+	return r.redact(value, appendPath(path, key))
+}
+
+// redactString masks key=value pairs with matching keys and detector matches within a string
+func (r *Redactor) redactString(s string) string {
+	if len(r.keys) > 0 {
+		s = keyValuePattern.ReplaceAllStringFunc(s, func(pair string) string {
+			parts := keyValuePattern.FindStringSubmatch(pair)
+			if !r.matchKey(parts[1]) {
+				return pair
+			}
+			if quote := parts[3][:1]; quote == `"` || quote == "'" {
+				return parts[1] + parts[2] + quote + r.mask + quote
+			}
+			return parts[1] + parts[2] + r.mask
+		})
+	}
+
+	for _, detector := range r.detectors {
+		s = detector.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if detector.Validate != nil && !detector.Validate(match) {
+				return match
+			}
+			return r.mask
+		})
+	}
+
+	return s
+}
+
+// matchKey reports whether an object key matches any key pattern
+func (r *Redactor) matchKey(key string) bool {
+	for _, pattern := range r.keys {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether the path matches any configured path
+func (r *Redactor) matchPath(path []string) bool {
+	for _, pattern := range r.paths {
+		if len(pattern) != len(path) {
+			continue
+		}
+
+		matched := true
+		for i := range pattern {
+			if pattern[i] != "*" && !strings.EqualFold(pattern[i], path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// appendPath returns a new path with the segment appended, leaving the parent path unchanged
+func appendPath(path []string, segment string) []string {
+	return append(path[:len(path):len(path)], segment)
+}
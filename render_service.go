@@ -0,0 +1,218 @@
+// -----------------------------------------------------------------------
+// Render Service
+// Fluent interface for rendering ApiResponse envelopes from handlers
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ternarybob/arbor"
+)
+
+type renderservice struct {
+	ctx      *gin.Context
+	config   *ServiceConfig
+	logger   arbor.ILogger
+	renderer *JSONRendererConfig // Renderer configuration, set by Recovery and ErrorHandler
+}
+
+// RenderService creates a render service for the gin context
+// The JSONMiddleware configuration, if any, is used unless WithConfig sets another service config
+// Usage: omnis.RenderService(c).WithConfig(config).WithLogger(logger).AsResult(200, data)
+func RenderService(ctx *gin.Context) IRenderService {
+	service := &renderservice{
+		ctx: ctx,
+	}
+
+	if renderer := getRendererConfig(ctx); renderer != nil {
+		service.config = renderer.ServiceConfig
+		service.renderer = renderer
+	}
+
+	return service
+}
+
+// getRendererConfig retrieves the JSONMiddleware configuration stored in the gin context, or nil if not set
+func getRendererConfig(c *gin.Context) *JSONRendererConfig {
+	if c == nil {
+		return nil
+	}
+	if config, ok := c.Get(RENDERER_CONFIG); ok {
+		if renderer, ok := config.(*JSONRendererConfig); ok {
+			return renderer
+		}
+	}
+	return nil
+}
+
+// WithConfig sets the service configuration used to populate the response metadata
+func (s *renderservice) WithConfig(config *ServiceConfig) IRenderService {
+	s.config = config
+	return s
+}
+
+// WithLogger sets the logger whose memory logs are included in the response
+// If not set, the request logger stored under REQUEST_LOGGER is used
+func (s *renderservice) WithLogger(logger arbor.ILogger) IRenderService {
+	s.logger = logger
+	return s
+}
+
+// AsResult renders a response with the result
+func (s *renderservice) AsResult(code int, result interface{}) {
+	response := s.newResponse(code)
+	response.Result = result
+
+	setResponseValue(s.ctx, result)
+	s.render(code, response)
+}
+
+// AsError renders an error response, with the stack when the scope is DEV
+func (s *renderservice) AsError(code int, err error) {
+	response := s.newResponse(code)
+	s.setError(response, err)
+
+	s.render(code, response)
+}
+
+// AsResultWithError renders a response with both the result and the error, with the stack when the scope is DEV
+func (s *renderservice) AsResultWithError(code int, result interface{}, err error) {
+	response := s.newResponse(code)
+	response.Result = result
+	s.setError(response, err)
+
+	setResponseValue(s.ctx, result)
+	s.render(code, response)
+}
+
+// AsModel merges the response metadata into the model and renders it
+// The model must be a pointer to a struct; fields are matched by their json tags (e.g. `json:"correlationid"`)
+func (s *renderservice) AsModel(code int, model interface{}) {
+	response := s.newResponse(code)
+
+	if err := mergeModel(response, model); err != nil {
+		if logger := s.getLogger(); logger != nil {
+			logger.Warn().Err(err).Msg("Unable to merge response into model")
+		}
+	}
+
+	s.render(code, model)
+}
+
+// newResponse creates an ApiResponse populated with the service metadata, correlation ID and memory logs
+// It shares its defaults with the JSONMiddleware envelope
+func (s *renderservice) newResponse(code int) *ApiResponse {
+	response := newServiceResponse(s.config, code)
+
+	if s.ctx != nil {
+		response.CorrelationId = s.ctx.GetString(CORRELATION_ID_KEY)
+		response.ClientCorrelationId = GetClientCorrelationID(s.ctx)
+		response.Request = requestDetails(s.ctx, s.rendererConfig())
+	}
+
+	response.Log = requestLogs(s.ctx, s.getLogger(), response.CorrelationId, captureLogLevel(s.ctx, s.rendererConfig()), s.rendererConfig())
+
+	return &response
+}
+
+// setError sets the error message and, when the scope is DEV, the stack of the caller
+// Without a service config or scope no stack is included
+func (s *renderservice) setError(response *ApiResponse, err error) {
+	if err == nil {
+		return
+	}
+
+	response.Error = err.Error()
+
+	if hasDevScope(s.config) {
+		// Skip setError and the As* method
+		response.Stack = stackTrace(2)
+	}
+
+	if logger := s.getLogger(); logger != nil {
+		logger.Warn().Err(err).Int("status_code", response.Status).Msg("Rendering error response")
+	}
+}
+
+// getLogger returns the configured logger or the request logger from the context
+func (s *renderservice) getLogger() arbor.ILogger {
+	if s.logger != nil {
+		return s.logger
+	}
+
+	if s.ctx != nil {
+		if loggerInterface, exists := s.ctx.Get(REQUEST_LOGGER); exists {
+			if requestLogger, ok := loggerInterface.(arbor.ILogger); ok {
+				return requestLogger
+			}
+		}
+	}
+
+	return nil
+}
+
+// render writes the response, pretty printed in DEV scope or when the renderer enables it
+// The context is marked so JSONMiddleware does not wrap the response again
+func (s *renderservice) render(code int, response interface{}) {
+	if s.ctx == nil {
+		return
+	}
+
+	s.ctx.Set(ENVELOPE_RENDERED, true)
+
+	renderer := s.rendererConfig()
+	if apiResponse, ok := response.(*ApiResponse); ok {
+		renderer.Redactor.ApplyWithEncoder(apiResponse, renderer.JSONEncoder)
+	}
+
+	if apiResponse, ok := response.(*ApiResponse); ok && renderer.ResponseFormat == FORMAT_PROBLEM && code >= http.StatusBadRequest {
+		s.ctx.Header("Content-Type", PROBLEM_CONTENT_TYPE)
+		response = newProblemDetails(apiResponse, hasDevScope(s.config))
+	}
+
+	if renderer.EnablePrettyPrint || hasDevScope(s.config) {
+		s.ctx.IndentedJSON(code, response)
+	} else {
+		s.ctx.JSON(code, response)
+	}
+}
+
+// rendererConfig returns the renderer configuration, or one holding just the service config
+// A service config set with WithConfig replaces the renderer's
+func (s *renderservice) rendererConfig() *JSONRendererConfig {
+	if s.renderer == nil {
+		return &JSONRendererConfig{ServiceConfig: s.config}
+	}
+	if s.renderer.ServiceConfig != s.config {
+		renderer := *s.renderer
+		renderer.ServiceConfig = s.config
+		return &renderer
+	}
+	return s.renderer
+}
+
+// mergeModel copies the populated response fields onto the model via their json representation
+// The result field is never copied so the model's own payload is preserved
+func mergeModel(response *ApiResponse, model interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "result")
+
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, model)
+}
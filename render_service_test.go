@@ -0,0 +1,225 @@
+// -----------------------------------------------------------------------
+// Render Service Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := &ServiceConfig{
+		Name:    "test-service",
+		Version: "1.2.3",
+		Build:   "2025-08-27-15-30",
+		Scope:   "DEV",
+	}
+
+	t.Run("AsResult", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+
+		r.GET("/test", func(c *gin.Context) {
+			RenderService(c).WithConfig(config).AsResult(http.StatusOK, gin.H{"users": []string{"alice", "bob"}})
+		})
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("X-Correlation-ID", "render-result")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "test-service", response.Name)
+		assert.Equal(t, "1.2.3", response.Version)
+		assert.Equal(t, "2025-08-27-15-30", response.Build)
+		assert.Equal(t, "DEV", response.Scope)
+		assert.Equal(t, http.StatusOK, response.Status)
+		assert.Equal(t, "render-result", response.CorrelationId)
+		assert.NotNil(t, response.Result)
+		assert.Empty(t, response.Error)
+		assert.Empty(t, response.Stack)
+	})
+
+	t.Run("AsError includes stack in DEV", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+
+		r.GET("/error", func(c *gin.Context) {
+			RenderService(c).WithConfig(config).AsError(http.StatusInternalServerError, errors.New("demonstration error"))
+		})
+
+		req, _ := http.NewRequest("GET", "/error", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "demonstration error", response.Error)
+		assert.Nil(t, response.Result)
+		require.NotEmpty(t, response.Stack)
+		assert.Contains(t, response.Stack[0], "TestRenderService")
+	})
+
+	t.Run("AsResultWithError omits stack outside DEV", func(t *testing.T) {
+		r := gin.New()
+
+		r.GET("/error", func(c *gin.Context) {
+			RenderService(c).
+				WithConfig(&ServiceConfig{Name: "test-service", Scope: "PRD"}).
+				AsResultWithError(http.StatusOK, gin.H{"partial": true}, errors.New("partial failure"))
+		})
+
+		req, _ := http.NewRequest("GET", "/error", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "partial failure", response.Error)
+		assert.Equal(t, map[string]interface{}{"partial": true}, response.Result)
+		assert.Empty(t, response.Stack)
+	})
+
+	t.Run("AsError omits stack without a scope", func(t *testing.T) {
+		r := gin.New()
+
+		r.GET("/error", func(c *gin.Context) {
+			RenderService(c).AsError(http.StatusInternalServerError, errors.New("no config"))
+		})
+		r.GET("/unscoped", func(c *gin.Context) {
+			RenderService(c).WithConfig(&ServiceConfig{Name: "test-service"}).AsError(http.StatusInternalServerError, errors.New("no scope"))
+		})
+
+		for _, path := range []string{"/error", "/unscoped"} {
+			req, _ := http.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusInternalServerError, w.Code)
+
+			var response ApiResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.NotEmpty(t, response.Error)
+			assert.Empty(t, response.Stack, path)
+			// Only a DEV scope pretty prints
+			assert.NotContains(t, w.Body.String(), "\n", path)
+		}
+	})
+
+	t.Run("Defaults match JSONMiddleware", func(t *testing.T) {
+		r := gin.New()
+		r.Use(JSONMiddleware(nil))
+
+		r.GET("/rendered", func(c *gin.Context) {
+			RenderService(c).AsResult(http.StatusOK, gin.H{"ok": true})
+		})
+		r.GET("/wrapped", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+
+		rendered := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/rendered"))
+		wrapped := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/wrapped"))
+		assert.Equal(t, "1.0.0", rendered.Version)
+		assert.Equal(t, wrapped.Version, rendered.Version)
+		assert.Empty(t, rendered.Name)
+		assert.Equal(t, wrapped.Name, rendered.Name)
+	})
+
+	t.Run("Uses JSONMiddleware config", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(JSONMiddlewareWithConfig(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Name: "middleware-service", Version: "2.0.0", Scope: "PRD"},
+		}))
+
+		r.GET("/error", func(c *gin.Context) {
+			RenderService(c).AsError(http.StatusConflict, errors.New("already exists"))
+		})
+
+		req, _ := http.NewRequest("GET", "/error", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusConflict, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "middleware-service", response.Name)
+		assert.Equal(t, "2.0.0", response.Version)
+		assert.Equal(t, "PRD", response.Scope)
+		assert.Equal(t, "already exists", response.Error)
+		assert.Empty(t, response.Stack)
+	})
+
+	t.Run("AsModel merges into struct", func(t *testing.T) {
+		type userProfile struct {
+			ID            int    `json:"id"`
+			Username      string `json:"username"`
+			Name          string `json:"name"`
+			Version       string `json:"version"`
+			Status        int    `json:"status"`
+			CorrelationId string `json:"correlationid"`
+		}
+
+		r := gin.New()
+		r.Use(SetCorrelationID())
+
+		r.GET("/profile", func(c *gin.Context) {
+			RenderService(c).WithConfig(config).AsModel(http.StatusOK, &userProfile{ID: 123, Username: "John Doe"})
+		})
+
+		req, _ := http.NewRequest("GET", "/profile", nil)
+		req.Header.Set("X-Correlation-ID", "render-model")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var profile userProfile
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+		assert.Equal(t, 123, profile.ID)
+		assert.Equal(t, "John Doe", profile.Username)
+		assert.Equal(t, "test-service", profile.Name)
+		assert.Equal(t, "1.2.3", profile.Version)
+		assert.Equal(t, http.StatusOK, profile.Status)
+		assert.Equal(t, "render-model", profile.CorrelationId)
+	})
+
+	t.Run("Not double wrapped by JSONMiddleware", func(t *testing.T) {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(JSONMiddleware(config))
+
+		r.GET("/test", func(c *gin.Context) {
+			RenderService(c).WithConfig(config).AsResult(http.StatusOK, gin.H{"message": "ok"})
+		})
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response ApiResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, map[string]interface{}{"message": "ok"}, response.Result)
+	})
+}
@@ -0,0 +1,167 @@
+// -----------------------------------------------------------------------
+// Request Capture
+// Request details for ApiResponse.Request, emitted in DEV scope or debug mode
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DEFAULT_MAX_BODY_SIZE is the number of request body bytes captured when RequestCaptureConfig.MaxBodySize is not set
+const DEFAULT_MAX_BODY_SIZE = 4096
+
+// Request fields for RequestCaptureConfig.Fields
+const (
+	REQUEST_FIELD_METHOD   = "method"   // HTTP method
+	REQUEST_FIELD_URL      = "url"      // Request URI, including the query string
+	REQUEST_FIELD_PATH     = "path"     // URL path
+	REQUEST_FIELD_ROUTE    = "route"    // Matched route template, e.g. /users/:id
+	REQUEST_FIELD_QUERY    = "query"    // Query parameters
+	REQUEST_FIELD_CLIENTIP = "clientip" // Client IP, as resolved by gin's trusted proxy settings
+)
+
+// RequestCaptureConfig allowlists the request details included in ApiResponse.Request
+// Details are only emitted in DEV scope or for authorized ?debug requests
+type RequestCaptureConfig struct {
+	Fields      []string // Request fields to include (default: method, url and route)
+	Headers     []string // Request headers to include, matched case-insensitively (default: none)
+	Body        bool     // Include the request body, up to MaxBodySize bytes
+	MaxBodySize int      // Maximum body bytes captured (default: 4096)
+}
+
+// defaultRequestCapture is used when JSONRendererConfig.RequestCapture is not set
+var defaultRequestCapture = &RequestCaptureConfig{
+	Fields: []string{REQUEST_FIELD_METHOD, REQUEST_FIELD_URL, REQUEST_FIELD_ROUTE},
+}
+
+// capturedBody is the start of the request body, stored in the context under REQUEST_BODY
+type capturedBody struct {
+	data      []byte
+	truncated bool
+}
+
+// requestCapture returns the configured request capture, or the default
+func requestCapture(config *JSONRendererConfig) *RequestCaptureConfig {
+	if config != nil && config.RequestCapture != nil {
+		return config.RequestCapture
+	}
+	return defaultRequestCapture
+}
+
+// captureRequestBody reads the start of the request body for ApiResponse.Request
+// The handler still reads the complete body, since the captured bytes are replayed before the rest
+func captureRequestBody(c *gin.Context, config *JSONRendererConfig) {
+	capture := requestCapture(config)
+	if !capture.Body || c.Request == nil || c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return
+	}
+	if !requestDetailsAllowed(c, config) {
+		return
+	}
+
+	limit := capture.MaxBodySize
+	if limit <= 0 {
+		limit = DEFAULT_MAX_BODY_SIZE
+	}
+
+	// Read one byte past the limit to detect truncation
+	body := c.Request.Body
+	prefix, err := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), errorReader{err}, body), body}
+
+	captured := capturedBody{data: prefix, truncated: len(prefix) > limit}
+	if captured.truncated {
+		captured.data = prefix[:limit]
+	}
+	c.Set(REQUEST_BODY, captured)
+}
+
+// errorReader replays a read error hit while capturing the body, or ends immediately
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+// requestDetailsAllowed reports whether request details may be emitted: in DEV scope or debug mode
+// Without a service config or scope, the scope is not DEV
+func requestDetailsAllowed(c *gin.Context, config *JSONRendererConfig) bool {
+	if config != nil && hasDevScope(config.ServiceConfig) {
+		return true
+	}
+	return debugRequested(c, config)
+}
+
+// requestDetails builds ApiResponse.Request from the allowlisted request details
+// It returns nil outside DEV scope and debug mode
+func requestDetails(c *gin.Context, config *JSONRendererConfig) map[string]interface{} {
+	if c == nil || c.Request == nil || !requestDetailsAllowed(c, config) {
+		return nil
+	}
+
+	capture := requestCapture(config)
+	details := map[string]interface{}{}
+
+	for _, field := range capture.Fields {
+		switch strings.ToLower(field) {
+		case REQUEST_FIELD_METHOD:
+			details[REQUEST_FIELD_METHOD] = c.Request.Method
+		case REQUEST_FIELD_URL:
+			details[REQUEST_FIELD_URL] = c.Request.URL.RequestURI()
+		case REQUEST_FIELD_PATH:
+			details[REQUEST_FIELD_PATH] = c.Request.URL.Path
+		case REQUEST_FIELD_ROUTE:
+			if route := c.FullPath(); route != "" {
+				details[REQUEST_FIELD_ROUTE] = route
+			}
+		case REQUEST_FIELD_QUERY:
+			query := map[string]interface{}{}
+			for key, values := range c.Request.URL.Query() {
+				if len(values) == 1 {
+					query[key] = values[0]
+				} else {
+					query[key] = values
+				}
+			}
+			details[REQUEST_FIELD_QUERY] = query
+		case REQUEST_FIELD_CLIENTIP:
+			details[REQUEST_FIELD_CLIENTIP] = c.ClientIP()
+		}
+	}
+
+	if len(capture.Headers) > 0 {
+		headers := map[string]interface{}{}
+		for _, name := range capture.Headers {
+			if values := c.Request.Header.Values(name); len(values) > 0 {
+				headers[strings.ToLower(name)] = strings.Join(values, ", ")
+			}
+		}
+		details["headers"] = headers
+	}
+
+	if body, ok := c.Get(REQUEST_BODY); ok {
+		if captured, ok := body.(capturedBody); ok {
+			details["body"] = string(captured.data)
+			if captured.truncated {
+				details["bodytruncated"] = true
+			}
+		}
+	}
+
+	return details
+}
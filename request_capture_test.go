@@ -0,0 +1,134 @@
+// -----------------------------------------------------------------------
+// Request Capture Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestCapture(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(config *JSONRendererConfig) *gin.Engine {
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(RecoveryWithConfig(config))
+		r.Use(JSONMiddlewareWithConfig(config))
+		r.POST("/users/:id", func(c *gin.Context) {
+			body, err := io.ReadAll(c.Request.Body)
+			require.NoError(t, err)
+			c.JSON(http.StatusOK, gin.H{"received": len(body)})
+		})
+		r.GET("/panic", func(c *gin.Context) {
+			panic("request capture")
+		})
+		return r
+	}
+
+	// captured sends the client address and headers the capture tests inspect
+	var captured requestOption = func(req *http.Request) {
+		req.RemoteAddr = "198.51.100.10:5555"
+		req.Header.Set("X-Correlation-ID", "capture-test")
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Add("Accept-Language", "en")
+		req.Header.Add("Accept-Language", "fr")
+	}
+
+	t.Run("Default Fields In DEV", func(t *testing.T) {
+		r := newRouter(&JSONRendererConfig{ServiceConfig: &ServiceConfig{Scope: "DEV"}})
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/users/7?expand=roles", captured, withBody("POST", "{}")))
+
+		assert.Equal(t, map[string]interface{}{
+			"method": "POST",
+			"url":    "/users/7?expand=roles",
+			"route":  "/users/:id",
+		}, response.Request)
+	})
+
+	t.Run("Omitted Outside DEV", func(t *testing.T) {
+		r := newRouter(&JSONRendererConfig{ServiceConfig: &ServiceConfig{Scope: "PRD"}})
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/users/7?debug", captured, withBody("POST", "{}")))
+
+		assert.Nil(t, response.Request)
+
+		for _, config := range []*JSONRendererConfig{nil, {ServiceConfig: &ServiceConfig{Name: "test-service"}}} {
+			response = decodeTestResponse[ApiResponse](t, serveTestRequest(newRouter(config), "/users/7", captured, withBody("POST", "{}")))
+			assert.Nil(t, response.Request, "without a scope")
+		}
+	})
+
+	t.Run("Authorized Debug Request", func(t *testing.T) {
+		r := newRouter(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Scope: "PRD"},
+			DebugPolicy:   &DebugPolicy{AllowedIPs: []string{"198.51.100.0/24"}},
+		})
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/users/7?debug", captured, withBody("POST", "{}")))
+
+		assert.Equal(t, "/users/:id", response.Request["route"])
+	})
+
+	t.Run("Allowlisted Details", func(t *testing.T) {
+		r := newRouter(&JSONRendererConfig{
+			ServiceConfig: &ServiceConfig{Scope: "DEV"},
+			RequestCapture: &RequestCaptureConfig{
+				Fields:  []string{REQUEST_FIELD_PATH, REQUEST_FIELD_QUERY, REQUEST_FIELD_CLIENTIP},
+				Headers: []string{"accept-language", "X-Missing"},
+			},
+		})
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/users/7?expand=roles&tag=a&tag=b", captured, withBody("POST", "{}")))
+
+		assert.Equal(t, map[string]interface{}{
+			"path":     "/users/7",
+			"query":    map[string]interface{}{"expand": "roles", "tag": []interface{}{"a", "b"}},
+			"clientip": "198.51.100.10",
+			"headers":  map[string]interface{}{"accept-language": "en, fr"},
+		}, response.Request)
+	})
+
+	t.Run("Size Limited Body", func(t *testing.T) {
+		r := newRouter(&JSONRendererConfig{
+			ServiceConfig:  &ServiceConfig{Scope: "DEV"},
+			RequestCapture: &RequestCaptureConfig{Body: true, MaxBodySize: 10},
+		})
+
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/users/7", captured, withBody("POST", `{"name":"a long request body"}`)))
+		assert.Equal(t, `{"name":"a`, response.Request["body"])
+		assert.Equal(t, true, response.Request["bodytruncated"])
+		// The handler still reads the complete body
+		assert.Equal(t, map[string]interface{}{"received": float64(30)}, response.Result)
+
+		response = decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/users/7", captured, withBody("POST", `{"a":1}`)))
+		assert.Equal(t, `{"a":1}`, response.Request["body"])
+		assert.NotContains(t, response.Request, "bodytruncated")
+	})
+
+	t.Run("Redacted Headers", func(t *testing.T) {
+		redactor, err := NewRedactor(RedactionConfig{Paths: []string{"request.headers.authorization"}})
+		require.NoError(t, err)
+
+		r := newRouter(&JSONRendererConfig{
+			ServiceConfig:  &ServiceConfig{Scope: "DEV"},
+			RequestCapture: &RequestCaptureConfig{Headers: []string{"Authorization"}},
+			Redactor:       redactor,
+		})
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/users/7", captured, withBody("POST", "{}")))
+
+		assert.Equal(t, map[string]interface{}{"authorization": "[REDACTED]"}, response.Request["headers"])
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		r := newRouter(&JSONRendererConfig{ServiceConfig: &ServiceConfig{Scope: "DEV"}})
+		response := decodeTestResponse[ApiResponse](t, serveTestRequest(r, "/panic", captured))
+
+		assert.Equal(t, "request capture", response.Error)
+		assert.Equal(t, "/panic", response.Request["route"])
+	})
+}
@@ -0,0 +1,195 @@
+// -----------------------------------------------------------------------
+// Request Context
+// Correlation ID and request logger in the request's context.Context, for
+// code that does not depend on gin, and a slog handler that uses them
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+	"github.com/ternarybob/arbor"
+)
+
+// contextKey is the type of the keys omnis stores in a context.Context
+type contextKey int
+
+const (
+	correlationIDContextKey contextKey = iota
+	loggerContextKey
+)
+
+// ContextWithCorrelationID returns a copy of the context carrying the correlation ID
+// SetCorrelationID does this for the request's context
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDContextKey, correlationID)
+}
+
+// CorrelationIDFromContext retrieves the correlation ID from a request's context, or "" if not set
+// Usage: omnis.CorrelationIDFromContext(c.Request.Context())
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		return c.GetString(CORRELATION_ID_KEY)
+	}
+	correlationID, _ := ctx.Value(correlationIDContextKey).(string)
+	return correlationID
+}
+
+// ContextWithLogger returns a copy of the context carrying the request logger
+// WithLogger does this for the request's context
+func ContextWithLogger(ctx context.Context, logger arbor.ILogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// LoggerFromContext retrieves the request logger from a request's context, or nil if not set
+// Usage: omnis.LoggerFromContext(c.Request.Context())
+func LoggerFromContext(ctx context.Context) arbor.ILogger {
+	if ctx == nil {
+		return nil
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		return GetRequestLogger(c)
+	}
+	logger, _ := ctx.Value(loggerContextKey).(arbor.ILogger)
+	return logger
+}
+
+// setRequestContext replaces the request with one whose context has the value set by with
+func setRequestContext(c *gin.Context, with func(ctx context.Context) context.Context) {
+	if c.Request != nil {
+		c.Request = c.Request.WithContext(with(c.Request.Context()))
+	}
+}
+
+// ContextHandler is a slog.Handler for code that logs with a request's context
+// Each record is written to the context's request logger, so it is captured in the envelope,
+// and passed to the next handler, if any, with the correlation ID as the "correlationid" attribute.
+// The attribute is nested under any groups opened with WithGroup
+// Usage: logger := slog.New(omnis.NewContextHandler(slog.NewJSONHandler(os.Stdout, nil)))
+//
+//	logger.InfoContext(ctx, "order placed", "order", id)
+type ContextHandler struct {
+	next   slog.Handler
+	attrs  []groupedAttr
+	groups []string
+}
+
+// NewContextHandler creates a context handler passing records on to next, which may be nil
+func NewContextHandler(next slog.Handler) *ContextHandler {
+	return &ContextHandler{next: next}
+}
+
+// Enabled reports whether the next handler is enabled for the level or the context has a request logger,
+// whose writers apply their own levels
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return (h.next != nil && h.next.Enabled(ctx, level)) || LoggerFromContext(ctx) != nil
+}
+
+// Handle writes the record to the request logger and the next handler
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if logger := LoggerFromContext(ctx); logger != nil {
+		h.log(logger, record)
+	}
+
+	if h.next == nil || !h.next.Enabled(ctx, record.Level) {
+		return nil
+	}
+
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		record = record.Clone()
+		record.AddAttrs(slog.String(CORRELATION_ID_KEY, correlationID))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a handler adding the attributes to every record
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := &ContextHandler{next: h.next, groups: h.groups}
+	if h.next != nil {
+		derived.next = h.next.WithAttrs(attrs)
+	}
+	derived.attrs = make([]groupedAttr, 0, len(h.attrs)+len(attrs))
+	derived.attrs = append(derived.attrs, h.attrs...)
+	for _, attr := range attrs {
+		derived.attrs = append(derived.attrs, groupedAttr{groups: h.groups, attr: attr})
+	}
+	return derived
+}
+
+// WithGroup returns a handler nesting later attributes under the group
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	derived := &ContextHandler{next: h.next, attrs: h.attrs, groups: appendPath(h.groups, name)}
+	if h.next != nil {
+		derived.next = h.next.WithGroup(name)
+	}
+	return derived
+}
+
+// log writes the record to an arbor logger, with grouped attributes as dotted field names
+func (h *ContextHandler) log(logger arbor.ILogger, record slog.Record) {
+	fields := map[string]interface{}{}
+	for _, attr := range h.attrs {
+		setAttr(fields, attr.groups, attr.attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		setAttr(fields, h.groups, attr)
+		return true
+	})
+
+	var event arbor.ILogEvent
+	switch slogLevel(record.Level) {
+	case log.TraceLevel:
+		event = logger.Trace()
+	case log.DebugLevel:
+		event = logger.Debug()
+	case log.InfoLevel:
+		event = logger.Info()
+	case log.WarnLevel:
+		event = logger.Warn()
+	default:
+		event = logger.Error()
+	}
+
+	for key, value := range fields {
+		event = addField(event, key, value)
+	}
+	event.Msg(record.Message)
+}
+
+// addField adds a field to an arbor event, flattening nested groups into dotted names
+func addField(event arbor.ILogEvent, key string, value interface{}) arbor.ILogEvent {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for nestedKey, nestedValue := range v {
+			event = addField(event, key+"."+nestedKey, nestedValue)
+		}
+		return event
+	case string:
+		return event.Str(key, v)
+	case int64:
+		return event.Int64(key, v)
+	case uint64:
+		return event.Str(key, strconv.FormatUint(v, 10))
+	case float64:
+		return event.Float64(key, v)
+	case bool:
+		return event.Str(key, strconv.FormatBool(v))
+	case time.Time:
+		return event.Str(key, v.Format(time.RFC3339Nano))
+	default:
+		return event.Str(key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,166 @@
+// -----------------------------------------------------------------------
+// Request Context Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ternarybob/arbor"
+	"github.com/ternarybob/arbor/models"
+)
+
+func TestRequestContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Values", func(t *testing.T) {
+		ctx := context.Background()
+		assert.Empty(t, CorrelationIDFromContext(ctx))
+		assert.Nil(t, LoggerFromContext(ctx))
+
+		logger := arbor.NewLogger()
+		ctx = ContextWithLogger(ContextWithCorrelationID(ctx, "ctx-values"), logger)
+		assert.Equal(t, "ctx-values", CorrelationIDFromContext(ctx))
+		assert.Same(t, logger, LoggerFromContext(ctx))
+	})
+
+	t.Run("Set By Middleware", func(t *testing.T) {
+		defaultLogger := arbor.Logger().WithMemoryWriter(models.WriterConfiguration{})
+
+		var seen struct {
+			correlationID, ginCorrelationID string
+			logger, ginLogger               arbor.ILogger
+		}
+
+		// A service layer function that only knows context.Context
+		service := func(ctx context.Context) {
+			seen.correlationID = CorrelationIDFromContext(ctx)
+			seen.logger = LoggerFromContext(ctx)
+		}
+
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(JSONMiddlewareWithConfig(&JSONRendererConfig{
+			ServiceConfig:   &ServiceConfig{Name: "test-service", Scope: "DEV"},
+			DefaultLogger:   defaultLogger,
+			ProvisionLogger: true,
+		}))
+		r.GET("/orders", func(c *gin.Context) {
+			service(c.Request.Context())
+			// A gin context works as a context.Context too
+			seen.ginCorrelationID = CorrelationIDFromContext(c)
+			seen.ginLogger = LoggerFromContext(c)
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+
+		req, _ := http.NewRequest("GET", "/orders", nil)
+		req.Header.Set("X-Correlation-ID", "ctx-middleware")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, "ctx-middleware", seen.correlationID)
+		assert.Equal(t, "ctx-middleware", seen.ginCorrelationID)
+		require.NotNil(t, seen.logger)
+		assert.Same(t, seen.logger, seen.ginLogger)
+	})
+
+	t.Run("Set By Correlation Service", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+
+		id, err := CorrelationService(c).WithGenerator(SequentialGenerator("ctx-")).SetCorrelationID()
+		require.NoError(t, err)
+		assert.Equal(t, id, CorrelationIDFromContext(c.Request.Context()))
+	})
+}
+
+func TestContextHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Next Handler", func(t *testing.T) {
+		var output bytes.Buffer
+		logger := slog.New(NewContextHandler(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+		ctx := ContextWithCorrelationID(context.Background(), "ctx-next")
+		logger.With("service", "orders").InfoContext(ctx, "order placed", "order", "A-1")
+		logger.DebugContext(ctx, "below the next handler's level")
+		logger.Info("without a request context")
+
+		lines := bytes.Split(bytes.TrimSpace(output.Bytes()), []byte("\n"))
+		require.Len(t, lines, 2)
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(lines[0], &record))
+		assert.Equal(t, "order placed", record["msg"])
+		assert.Equal(t, "ctx-next", record["correlationid"])
+		assert.Equal(t, "orders", record["service"])
+		assert.Equal(t, "A-1", record["order"])
+
+		var unrelated map[string]interface{}
+		require.NoError(t, json.Unmarshal(lines[1], &unrelated))
+		assert.NotContains(t, unrelated, "correlationid")
+	})
+
+	t.Run("Disabled Without Next Handler Or Logger", func(t *testing.T) {
+		handler := NewContextHandler(nil)
+		assert.False(t, handler.Enabled(context.Background(), slog.LevelError))
+		assert.True(t, handler.Enabled(ContextWithLogger(context.Background(), arbor.NewLogger()), slog.LevelDebug))
+		slog.New(handler).ErrorContext(context.Background(), "dropped")
+	})
+
+	t.Run("Captured In The Envelope", func(t *testing.T) {
+		var output bytes.Buffer
+		logger := slog.New(NewContextHandler(slog.NewTextHandler(&output, nil)))
+
+		// A repository function logging with only the request's context
+		repository := func(ctx context.Context) {
+			logger.WithGroup("db").InfoContext(ctx, "query", "table", "orders", "rows", 3)
+			logger.WarnContext(ctx, "slow query", "err", errors.New("timeout"))
+		}
+
+		r := gin.New()
+		r.Use(SetCorrelationID())
+		r.Use(JSONMiddlewareWithConfig(&JSONRendererConfig{
+			ServiceConfig:   &ServiceConfig{Name: "test-service", Scope: "DEV"},
+			DefaultLogger:   arbor.NewLogger(),
+			ProvisionLogger: true,
+			LogFormat:       LOG_FORMAT_STRUCTURED,
+			LogBufferSize:   16,
+		}))
+		r.GET("/orders", func(c *gin.Context) {
+			repository(c.Request.Context())
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+
+		req, _ := http.NewRequest("GET", "/orders", nil)
+		req.Header.Set("X-Correlation-ID", "ctx-envelope")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Log struct {
+				Entries []LogEntry `json:"entries"`
+			} `json:"log"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		require.Len(t, response.Log.Entries, 2)
+		assert.Equal(t, "query", response.Log.Entries[0].Message)
+		assert.Equal(t, map[string]interface{}{"db.table": "orders", "db.rows": float64(3)}, response.Log.Entries[0].Fields)
+		assert.Equal(t, "warn", response.Log.Entries[1].Level)
+		assert.Equal(t, "timeout", response.Log.Entries[1].Fields["err"])
+
+		assert.Contains(t, output.String(), "correlationid=ctx-envelope")
+	})
+}
@@ -0,0 +1,210 @@
+// -----------------------------------------------------------------------
+// Trace Context
+// W3C Trace Context (traceparent/tracestate) for SetCorrelationID, the
+// trace model shared by every propagator
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// W3C Trace Context headers
+const (
+	TRACEPARENT_HEADER = "traceparent"
+	TRACESTATE_HEADER  = "tracestate"
+)
+
+// TRACE_CONTEXT_KEY is the key used to store the request's TraceContext in gin.Context
+const TRACE_CONTEXT_KEY = "omnis_trace_context"
+
+// Limits on an inbound tracestate; longer values are dropped rather than propagated
+const (
+	MAX_TRACESTATE_LENGTH  = 512
+	MAX_TRACESTATE_MEMBERS = 32
+)
+
+// TraceContext is the trace context of a request, in W3C form whichever propagator extracted it
+// SpanID identifies this hop; ParentSpanID is the caller's span, empty when this hop started the trace
+type TraceContext struct {
+	TraceID      string // 32 lowercase hex characters
+	SpanID       string // 16 lowercase hex characters
+	ParentSpanID string // 16 lowercase hex characters, or empty
+	Flags        string // 2 hex characters, "01" when the caller sampled the trace
+	State        string // Vendor-specific tracestate, propagated unchanged
+}
+
+// Traceparent formats the trace context as a version 00 traceparent header for this hop
+func (t TraceContext) Traceparent() string {
+	if t.TraceID == "" || t.SpanID == "" {
+		return ""
+	}
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// Sampled reports whether the sampled flag is set
+func (t TraceContext) Sampled() bool {
+	flags, err := hex.DecodeString(t.Flags)
+	return err == nil && len(flags) == 1 && flags[0]&0x01 == 1
+}
+
+// childTraceContext continues the caller's extracted trace with a new span for this hop,
+// or starts a new trace, which is not sampled, when the caller sent none
+func childTraceContext(parent TraceContext) TraceContext {
+	if parent.TraceID != "" && parent.SpanID != "" {
+		return TraceContext{
+			TraceID:      parent.TraceID,
+			SpanID:       randomHex(8),
+			ParentSpanID: parent.SpanID,
+			Flags:        parent.Flags,
+			State:        parent.State,
+		}
+	}
+
+	return TraceContext{
+		TraceID: randomHex(16),
+		SpanID:  randomHex(8),
+		Flags:   "00",
+	}
+}
+
+// parseTraceparent parses and validates a traceparent header
+// Versions after 00 are accepted by their first four fields, as the specification requires
+func parseTraceparent(value string) (TraceContext, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 {
+		return TraceContext{}, false
+	}
+
+	version := value[0:2]
+	if !isLowerHex(version) || version == "ff" {
+		return TraceContext{}, false
+	}
+	if version == "00" && len(value) != 55 {
+		return TraceContext{}, false
+	}
+	if len(value) > 55 && value[55] != '-' {
+		return TraceContext{}, false
+	}
+
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return TraceContext{}, false
+	}
+
+	traceID, spanID, flags := value[3:35], value[36:52], value[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return TraceContext{}, false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return TraceContext{}, false
+	}
+
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: flags}, true
+}
+
+// validTracestate returns the tracestate if it is within the length and list member limits
+func validTracestate(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || len(value) > MAX_TRACESTATE_LENGTH {
+		return ""
+	}
+
+	members := 0
+	for _, member := range strings.Split(value, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		key, _, found := strings.Cut(member, "=")
+		if !found || key == "" {
+			return ""
+		}
+		members++
+	}
+	if members > MAX_TRACESTATE_MEMBERS {
+		return ""
+	}
+	return value
+}
+
+// isLowerHex reports whether the string only contains lowercase hex digits
+func isLowerHex(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex returns n random bytes as lowercase hex, never all zeros
+func randomHex(n int) string {
+	id := make([]byte, n)
+	for {
+		if _, err := rand.Read(id); err != nil {
+			panic(err) // crypto/rand does not fail on supported platforms
+		}
+		for _, b := range id {
+			if b != 0 {
+				return hex.EncodeToString(id)
+			}
+		}
+	}
+}
+
+// GetTraceContext retrieves the request's trace context from the gin context
+// Returns false if SetCorrelationID has not run
+func GetTraceContext(c *gin.Context) (TraceContext, bool) {
+	if c == nil {
+		return TraceContext{}, false
+	}
+	trace, ok := c.Value(TRACE_CONTEXT_KEY).(TraceContext)
+	return trace, ok
+}
+
+// GetTraceID retrieves the trace ID, or "" if not set
+func GetTraceID(c *gin.Context) string {
+	trace, _ := GetTraceContext(c)
+	return trace.TraceID
+}
+
+// GetSpanID retrieves this hop's span ID, or "" if not set
+func GetSpanID(c *gin.Context) string {
+	trace, _ := GetTraceContext(c)
+	return trace.SpanID
+}
+
+// GetParentSpanID retrieves the caller's span ID, or "" if this hop started the trace
+func GetParentSpanID(c *gin.Context) string {
+	trace, _ := GetTraceContext(c)
+	return trace.ParentSpanID
+}
+
+// GetTraceparent retrieves the traceparent to send on downstream requests, or "" if not set
+// Usage: req.Header.Set("traceparent", omnis.GetTraceparent(c))
+func GetTraceparent(c *gin.Context) string {
+	trace, _ := GetTraceContext(c)
+	return trace.Traceparent()
+}
+
+// InjectTraceContext sets the correlation and trace headers of a downstream request with the
+// request's propagator, so the next hop continues this request's trace as a child of this hop's span
+// Usage: omnis.InjectTraceContext(c, req.Header)
+func InjectTraceContext(c *gin.Context, header http.Header) {
+	trace, ok := GetTraceContext(c)
+	if !ok || header == nil {
+		return
+	}
+
+	requestPropagator(c).Inject(PropagationContext{
+		CorrelationID: c.GetString(CORRELATION_ID_KEY),
+		Trace:         trace,
+	}, header)
+}
@@ -0,0 +1,143 @@
+// -----------------------------------------------------------------------
+// Trace Context Tests
+// -----------------------------------------------------------------------
+
+package omnis
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceContext(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+
+	t.Run("Parse Traceparent", func(t *testing.T) {
+		trace, ok := parseTraceparent("00-" + traceID + "-" + parentID + "-01")
+		require.True(t, ok)
+		assert.Equal(t, TraceContext{TraceID: traceID, SpanID: parentID, Flags: "01"}, trace)
+		assert.True(t, trace.Sampled())
+
+		// Later versions may append fields
+		_, ok = parseTraceparent("cc-" + traceID + "-" + parentID + "-00-extra")
+		assert.True(t, ok)
+
+		invalid := []string{
+			"",
+			"00-" + traceID + "-" + parentID,
+			"00-" + traceID + "-" + parentID + "-01-extra",
+			"ff-" + traceID + "-" + parentID + "-01",
+			"00-" + strings.ToUpper(traceID) + "-" + parentID + "-01",
+			"00-00000000000000000000000000000000-" + parentID + "-01",
+			"00-" + traceID + "-0000000000000000-01",
+			"00-" + traceID + "-" + parentID + "-0g",
+			"00_" + traceID + "_" + parentID + "_01",
+			"cc-" + traceID + "-" + parentID + "-00extra",
+		}
+		for _, value := range invalid {
+			_, ok := parseTraceparent(value)
+			assert.False(t, ok, value)
+		}
+	})
+
+	t.Run("Tracestate", func(t *testing.T) {
+		assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", validTracestate("congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"))
+		assert.Empty(t, validTracestate("no-equals-sign"))
+		assert.Empty(t, validTracestate(strings.Repeat("a=b,", 33)))
+		assert.Empty(t, validTracestate("k="+strings.Repeat("v", MAX_TRACESTATE_LENGTH)))
+	})
+
+	t.Run("Child Span", func(t *testing.T) {
+		trace := childTraceContext(TraceContext{TraceID: traceID, SpanID: parentID, Flags: "01", State: "rojo=1"})
+		assert.Equal(t, traceID, trace.TraceID)
+		assert.Equal(t, parentID, trace.ParentSpanID)
+		assert.Len(t, trace.SpanID, 16)
+		assert.NotEqual(t, parentID, trace.SpanID)
+		assert.Equal(t, "rojo=1", trace.State)
+		assert.Equal(t, "00-"+traceID+"-"+trace.SpanID+"-01", trace.Traceparent())
+	})
+
+	t.Run("New Trace", func(t *testing.T) {
+		trace := childTraceContext(TraceContext{State: "rojo=1"})
+		assert.Len(t, trace.TraceID, 32)
+		assert.Len(t, trace.SpanID, 16)
+		assert.Empty(t, trace.ParentSpanID)
+		assert.Empty(t, trace.State)
+		assert.False(t, trace.Sampled())
+
+		_, ok := parseTraceparent(trace.Traceparent())
+		assert.True(t, ok)
+	})
+}
+
+func TestSetCorrelationIDTraceContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+
+	var seen struct {
+		correlationID, traceID, spanID, parentSpanID string
+		downstream                                   http.Header
+	}
+
+	r := gin.New()
+	r.Use(SetCorrelationID())
+	r.GET("/hop", func(c *gin.Context) {
+		seen.correlationID = GetCorrelationID(c)
+		seen.traceID = GetTraceID(c)
+		seen.spanID = GetSpanID(c)
+		seen.parentSpanID = GetParentSpanID(c)
+		seen.downstream = http.Header{}
+		InjectTraceContext(c, seen.downstream)
+		c.String(http.StatusOK, "ok")
+	})
+
+	t.Run("Continues The Caller's Trace", func(t *testing.T) {
+		w := serveTestRequest(r, "/hop",
+			withHeader("traceparent", "00-"+traceID+"-"+parentID+"-01"),
+			withHeader("tracestate", "congo=t61rcWkgMzE"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, traceID, seen.traceID)
+		assert.Equal(t, parentID, seen.parentSpanID)
+		assert.NotEqual(t, parentID, seen.spanID)
+		// Without X-Correlation-ID, the correlation ID is the trace ID
+		assert.Equal(t, traceID, seen.correlationID)
+		assert.Equal(t, traceID, w.Header().Get("X-Correlation-ID"))
+
+		traceparent := "00-" + traceID + "-" + seen.spanID + "-01"
+		assert.Equal(t, traceparent, w.Header().Get("traceparent"))
+		assert.Equal(t, "congo=t61rcWkgMzE", w.Header().Get("tracestate"))
+		assert.Equal(t, traceparent, seen.downstream.Get("traceparent"))
+		assert.Equal(t, "congo=t61rcWkgMzE", seen.downstream.Get("tracestate"))
+	})
+
+	t.Run("Keeps An Explicit Correlation ID", func(t *testing.T) {
+		serveTestRequest(r, "/hop",
+			withHeader("traceparent", "00-"+traceID+"-"+parentID+"-01"),
+			withHeader("X-Correlation-ID", "order-123"))
+
+		assert.Equal(t, "order-123", seen.correlationID)
+		assert.Equal(t, traceID, seen.traceID)
+	})
+
+	t.Run("Starts A Trace For Invalid Headers", func(t *testing.T) {
+		w := serveTestRequest(r, "/hop",
+			withHeader("traceparent", "00-"+traceID+"-0000000000000000-01"),
+			withHeader("tracestate", "congo=t61rcWkgMzE"))
+
+		assert.NotEqual(t, traceID, seen.traceID)
+		assert.Empty(t, seen.parentSpanID)
+		// The correlation ID is still a generated UUID
+		assert.Len(t, seen.correlationID, 36)
+		assert.Equal(t, "00-"+seen.traceID+"-"+seen.spanID+"-00", w.Header().Get("traceparent"))
+		assert.Empty(t, w.Header().Get("tracestate"))
+	})
+}